@@ -0,0 +1,89 @@
+package sqsch
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Ack deletes a message and waits for the result. The message is batched with
+// other deletes exactly as if it were sent to the delete channel, but Ack blocks
+// until the DeleteMessageBatch request containing it returns. It returns nil if
+// the message was deleted, a *BatchDeleteError if its entry failed, the error
+// returned by the request, ctx.Err() if ctx is done first, or ErrShutdown if the
+// Dispatch no longer accepts deletes.
+func (d *Dispatch) Ack(ctx context.Context, message *sqs.Message) error {
+	select {
+	case <-d.stopping:
+		return ErrShutdown
+	default:
+	}
+
+	done := d.acks.wait(message)
+
+	select {
+	case d.deletes <- message:
+	case <-d.stopping:
+		d.acks.cancel(message)
+		return ErrShutdown
+	case <-ctx.Done():
+		d.acks.cancel(message)
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-d.stopped:
+		// the message may have been sent after deletes stopped being read
+		select {
+		case err := <-done:
+			return err
+		default:
+			d.acks.cancel(message)
+			return ErrShutdown
+		}
+	case <-ctx.Done():
+		d.acks.cancel(message)
+		return ctx.Err()
+	}
+}
+
+// acks tracks callers waiting for the result of deleting a message
+type acks struct {
+	mutex   sync.Mutex
+	waiters map[*sqs.Message]chan error
+}
+
+func newAcks() *acks {
+	return &acks{waiters: make(map[*sqs.Message]chan error)}
+}
+
+func (a *acks) wait(message *sqs.Message) <-chan error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	done := make(chan error, 1)
+	a.waiters[message] = done
+
+	return done
+}
+
+func (a *acks) cancel(message *sqs.Message) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	delete(a.waiters, message)
+}
+
+// done sends the result of deleting a message to its waiter, if any
+func (a *acks) done(message *sqs.Message, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if done, ok := a.waiters[message]; ok {
+		done <- err
+		delete(a.waiters, message)
+	}
+}
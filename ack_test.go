@@ -0,0 +1,108 @@
+package sqsch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAck(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl: aws.String("http://foo.bar"),
+	}
+
+	blockReceives(sqsapi)
+
+	sqsapi.
+		EXPECT().
+		DeleteMessageBatchWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, input *sqs.DeleteMessageBatchInput) (*sqs.DeleteMessageBatchOutput, error) {
+			output := &sqs.DeleteMessageBatchOutput{}
+
+			for _, entry := range input.Entries {
+				if aws.StringValue(entry.ReceiptHandle) == "invalid" {
+					output.Failed = append(output.Failed, &sqs.BatchResultErrorEntry{
+						Id:      entry.Id,
+						Code:    aws.String("ReceiptHandleIsInvalid"),
+						Message: aws.String("invalid handle"),
+					})
+				}
+			}
+
+			return output, nil
+		})
+
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: input},
+		Delete:  DeleteOptions{Interval: time.Hour},
+	})
+
+	dispatch.Start(ctx)
+
+	ok := make(chan error)
+	go func() {
+		ok <- dispatch.Ack(ctx, &sqs.Message{ReceiptHandle: aws.String("ok")})
+	}()
+
+	go func() {
+		for i := 0; i < MaxBatchSize-2; i++ {
+			dispatch.Deletes() <- &sqs.Message{ReceiptHandle: aws.String("other")}
+		}
+	}()
+
+	err := dispatch.Ack(ctx, &sqs.Message{ReceiptHandle: aws.String("invalid")})
+	assert.EqualError(t, err, "SQS batch delete error: invalid handle (ReceiptHandleIsInvalid)")
+	assert.NoError(t, <-ok)
+}
+
+func TestAckRequestError(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl: aws.String("http://foo.bar"),
+	}
+
+	blockReceives(sqsapi)
+
+	sqsapi.
+		EXPECT().
+		DeleteMessageBatchWithContext(gomock.Any(), gomock.Any()).
+		Return(nil, errors.New("SQS error"))
+
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: input},
+		Delete:  DeleteOptions{Interval: time.Millisecond},
+	})
+
+	dispatch.Start(ctx)
+
+	err := dispatch.Ack(ctx, &sqs.Message{ReceiptHandle: aws.String("handle")})
+	assert.EqualError(t, err, "SQS error")
+}
+
+func TestAckCanceled(t *testing.T) {
+	dispatch := newUnvalidated(Options{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for i := 0; i < MaxBatchSize; i++ {
+		dispatch.deletes <- &sqs.Message{}
+	}
+
+	err := dispatch.Ack(ctx, &sqs.Message{})
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, dispatch.acks.waiters)
+}
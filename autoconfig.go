@@ -0,0 +1,232 @@
+package sqsch
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/bendrucker/sqs-receive-channel/pkg/redrive"
+)
+
+// QueueAttributes are the attributes of a queue that Options.AutoConfigure learns with GetQueueAttributes
+type QueueAttributes struct {
+	QueueURL          string
+	VisibilityTimeout time.Duration
+	FIFO              bool
+	// RedrivePolicy is nil if the queue does not have a dead-letter queue
+	RedrivePolicy *redrive.Policy
+	// ReceiveWaitTime is the queue's default ReceiveMessageWaitTimeSeconds, which replaces
+	// the default WaitTimeSeconds when it is positive
+	ReceiveWaitTime time.Duration
+}
+
+// QueueAttributesError represents a failure to get or parse the attributes of a queue
+type QueueAttributesError struct {
+	QueueURL string
+	Err      error
+}
+
+func (err *QueueAttributesError) Error() string {
+	return fmt.Sprintf("failed to get attributes of queue %s: %s", err.QueueURL, err.Err)
+}
+
+// Unwrap returns the underlying error
+func (err *QueueAttributesError) Unwrap() error {
+	return err.Err
+}
+
+// ConfigurationWarning describes an option that contradicts the attributes of a queue
+type ConfigurationWarning struct {
+	Field    string
+	QueueURL string
+	Reason   string
+}
+
+func (w *ConfigurationWarning) String() string {
+	return fmt.Sprintf("%s: %s", w.Field, w.Reason)
+}
+
+// QueueAttributes returns the attributes of a queue learned by Options.AutoConfigure,
+// or nil if they were not requested
+func (d *Dispatch) QueueAttributes(queueURL *string) *QueueAttributes {
+	return d.attributes[aws.StringValue(queueURL)]
+}
+
+// Warnings returns the contradictions between options and queue attributes found by
+// Options.AutoConfigure. Each is also logged at LogWarn.
+func (d *Dispatch) Warnings() []*ConfigurationWarning {
+	return d.warnings
+}
+
+// autoConfigure gets the attributes of each queue, derives options that were not set, and
+// records warnings about options that contradict the attributes. heartbeat is the
+// HeartbeatOptions before defaults were set.
+func (d *Dispatch) autoConfigure(ctx context.Context, heartbeat HeartbeatOptions) error {
+	urls := []*string{d.QueueURL()}
+	if len(d.Options.Receive.Queues) > 0 {
+		urls = d.Options.Receive.order()
+	}
+
+	d.attributes = make(map[string]*QueueAttributes)
+
+	var all []*QueueAttributes
+	for _, url := range urls {
+		attributes, err := d.getQueueAttributes(ctx, url)
+		if err != nil {
+			return err
+		}
+
+		d.attributes[attributes.QueueURL] = attributes
+		all = append(all, attributes)
+	}
+
+	d.derive(all, heartbeat)
+
+	for _, attributes := range all {
+		d.check(ctx, attributes)
+	}
+
+	return nil
+}
+
+func (d *Dispatch) getQueueAttributes(ctx context.Context, url *string) (*QueueAttributes, error) {
+	// FifoQueue is only a valid attribute name for FIFO queues, so all attributes are requested
+	output, err := d.Options.SQS.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       url,
+		AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameAll}),
+	})
+
+	if err != nil {
+		return nil, &QueueAttributesError{QueueURL: aws.StringValue(url), Err: err}
+	}
+
+	seconds := func(name string) (time.Duration, error) {
+		value, ok := output.Attributes[name]
+		if !ok {
+			return 0, nil
+		}
+
+		n, err := strconv.Atoi(aws.StringValue(value))
+		return time.Duration(n) * time.Second, err
+	}
+
+	attributes := &QueueAttributes{
+		QueueURL: aws.StringValue(url),
+		FIFO:     aws.StringValue(output.Attributes[sqs.QueueAttributeNameFifoQueue]) == "true",
+	}
+
+	if attributes.VisibilityTimeout, err = seconds(sqs.QueueAttributeNameVisibilityTimeout); err != nil {
+		return nil, &QueueAttributesError{QueueURL: attributes.QueueURL, Err: err}
+	}
+
+	if attributes.ReceiveWaitTime, err = seconds(sqs.QueueAttributeNameReceiveMessageWaitTimeSeconds); err != nil {
+		return nil, &QueueAttributesError{QueueURL: attributes.QueueURL, Err: err}
+	}
+
+	if policy := aws.StringValue(output.Attributes[sqs.QueueAttributeNameRedrivePolicy]); policy != "" {
+		if attributes.RedrivePolicy, err = redrive.Parse(policy); err != nil {
+			return nil, &QueueAttributesError{QueueURL: attributes.QueueURL, Err: err}
+		}
+	}
+
+	return attributes, nil
+}
+
+// visibilityTimeout returns the visibility timeout that received messages have
+func (d *Dispatch) visibilityTimeout(attributes *QueueAttributes) time.Duration {
+	if timeout := d.Options.Receive.RecieveMessageInput.VisibilityTimeout; timeout != nil {
+		return time.Duration(*timeout) * time.Second
+	}
+
+	return attributes.VisibilityTimeout
+}
+
+// derive sets options that were not set from the attributes of the queues. Heartbeats that
+// are enabled without a VisibilityTimeout extend messages by the shortest visibility timeout
+// of all queues, but heartbeats are never enabled. Receive.FIFO and the wait time are only
+// derived when receiving from a single queue.
+func (d *Dispatch) derive(all []*QueueAttributes, heartbeat HeartbeatOptions) {
+	timeout := d.visibilityTimeout(all[0])
+	for _, attributes := range all[1:] {
+		if t := d.visibilityTimeout(attributes); t < timeout {
+			timeout = t
+		}
+	}
+
+	if heartbeat.Enabled() && heartbeat.VisibilityTimeout == 0 && timeout > heartbeat.Interval {
+		d.Options.Heartbeat.VisibilityTimeout = timeout
+	}
+
+	if len(all) != 1 {
+		return
+	}
+
+	if all[0].FIFO {
+		d.Options.Receive.FIFO = true
+	}
+
+	// a queue without a wait time is indistinguishable from one that disables long polling,
+	// so only a positive wait time replaces the default
+	if input := d.Options.Receive.RecieveMessageInput; input.WaitTimeSeconds == nil && all[0].ReceiveWaitTime > 0 {
+		copied := *input
+		copied.WaitTimeSeconds = aws.Int64(int64(all[0].ReceiveWaitTime / time.Second))
+		d.Options.Receive.RecieveMessageInput = &copied
+	}
+}
+
+// FinalReceive returns whether a message will be moved to its queue's dead-letter queue if it
+// is received again, according to the redrive policy learned by Options.AutoConfigure. It
+// returns false if the queue has no redrive policy or its attributes were not requested.
+func (d *Dispatch) FinalReceive(message *sqs.Message) bool {
+	attributes := d.QueueAttributes(d.MessageQueueURL(message))
+	if attributes == nil || attributes.RedrivePolicy == nil {
+		return false
+	}
+
+	return ReceiveCount(message) >= attributes.RedrivePolicy.MaxReceiveCount
+}
+
+// redrive returns whether any queue has a redrive policy
+func (d *Dispatch) redrive() bool {
+	for _, attributes := range d.attributes {
+		if attributes.RedrivePolicy != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check records a warning for each option that contradicts the attributes of a queue
+func (d *Dispatch) check(ctx context.Context, attributes *QueueAttributes) {
+	warn := func(field, format string, args ...interface{}) {
+		warning := &ConfigurationWarning{Field: field, QueueURL: attributes.QueueURL, Reason: fmt.Sprintf(format, args...)}
+		d.warnings = append(d.warnings, warning)
+		d.log(ctx, LogWarn, "configuration warning", aws.String(attributes.QueueURL), LogKeyField, warning.Field, LogKeyError, warning.Reason)
+	}
+
+	timeout := d.visibilityTimeout(attributes)
+
+	if d.Options.Delete.Interval >= timeout {
+		warn("Delete.Interval", "%s is not shorter than the visibility timeout (%s), so messages can be received again before they are deleted", d.Options.Delete.Interval, timeout)
+	}
+
+	if d.Options.Heartbeat.Enabled() && d.Options.Heartbeat.Interval >= timeout {
+		warn("Heartbeat.Interval", "%s is not shorter than the visibility timeout (%s), so messages can be received again between heartbeats", d.Options.Heartbeat.Interval, timeout)
+	}
+
+	if d.Options.Receive.FIFO && !attributes.FIFO {
+		warn("Receive.FIFO", "is set but the queue is not a FIFO queue")
+	}
+
+	if !d.Options.Receive.FIFO && attributes.FIFO {
+		warn("Receive.FIFO", "is not set but the queue is a FIFO queue, so message groups are not delivered in order")
+	}
+
+	if d.Options.Heartbeat.Enabled() && d.Options.Heartbeat.MaxLease < timeout {
+		warn("Heartbeat.MaxLease", "%s is shorter than the visibility timeout (%s), so heartbeats never extend messages", d.Options.Heartbeat.MaxLease, timeout)
+	}
+}
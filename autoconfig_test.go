@@ -0,0 +1,163 @@
+package sqsch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/bendrucker/sqs-receive-channel/fake"
+	"github.com/bendrucker/sqs-receive-channel/pkg/redrive"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoConfigure(t *testing.T) {
+	sqsapi := fake.New(fake.Options{})
+	queue, err := sqsapi.CreateQueue(&sqs.CreateQueueInput{
+		QueueName: aws.String("queue.fifo"),
+		Attributes: aws.StringMap(map[string]string{
+			"FifoQueue":                     "true",
+			"VisibilityTimeout":             "60",
+			"ReceiveMessageWaitTimeSeconds": "10",
+			"RedrivePolicy":                 `{"deadLetterTargetArn":"arn:aws:sqs:us-east-1:000000000000:dlq","maxReceiveCount":"3"}`,
+		}),
+	})
+	assert.NoError(t, err)
+
+	input := &sqs.ReceiveMessageInput{QueueUrl: queue.QueueUrl}
+	dispatch := mustNew(t, Options{
+		SQS:           sqsapi,
+		AutoConfigure: true,
+		Receive:       ReceiveOptions{RecieveMessageInput: input},
+	})
+
+	assert.Equal(t, &QueueAttributes{
+		QueueURL:          *queue.QueueUrl,
+		VisibilityTimeout: 60 * time.Second,
+		FIFO:              true,
+		RedrivePolicy:     &redrive.Policy{DeadLetterTargetArn: "arn:aws:sqs:us-east-1:000000000000:dlq", MaxReceiveCount: 3},
+		ReceiveWaitTime:   10 * time.Second,
+	}, dispatch.QueueAttributes(queue.QueueUrl))
+
+	assert.True(t, dispatch.Options.Receive.FIFO)
+	assert.Equal(t, 10*time.Second, dispatch.Options.Receive.waitTime())
+	assert.Nil(t, input.WaitTimeSeconds, "does not modify the input")
+	assert.False(t, dispatch.Options.Heartbeat.Enabled(), "does not enable heartbeats")
+	assert.Empty(t, dispatch.Warnings())
+
+	assert.Contains(t, aws.StringValueSlice(dispatch.attributeNames()), ApproximateReceiveCount)
+
+	message := &sqs.Message{Attributes: aws.StringMap(map[string]string{ApproximateReceiveCount: "2"})}
+	assert.False(t, dispatch.FinalReceive(message))
+	message.Attributes[ApproximateReceiveCount] = aws.String("3")
+	assert.True(t, dispatch.FinalReceive(message))
+}
+
+func TestAutoConfigureExplicit(t *testing.T) {
+	sqsapi := fake.New(fake.Options{})
+	queue, err := sqsapi.CreateQueue(&sqs.CreateQueueInput{
+		QueueName: aws.String("queue"),
+		Attributes: aws.StringMap(map[string]string{
+			"VisibilityTimeout":             "60",
+			"ReceiveMessageWaitTimeSeconds": "10",
+		}),
+	})
+	assert.NoError(t, err)
+
+	dispatch := mustNew(t, Options{
+		SQS:           sqsapi,
+		AutoConfigure: true,
+		Receive: ReceiveOptions{
+			RecieveMessageInput: &sqs.ReceiveMessageInput{
+				QueueUrl:          queue.QueueUrl,
+				VisibilityTimeout: aws.Int64(90),
+				WaitTimeSeconds:   aws.Int64(5),
+			},
+		},
+		Heartbeat: HeartbeatOptions{Interval: 10 * time.Second},
+	})
+
+	assert.Equal(t, 10*time.Second, dispatch.Options.Heartbeat.Interval, "does not override heartbeats")
+	assert.Equal(t, 90*time.Second, dispatch.Options.Heartbeat.VisibilityTimeout, "extends by the requested visibility timeout")
+	assert.Equal(t, 5*time.Second, dispatch.Options.Receive.waitTime(), "does not override the wait time")
+	assert.Empty(t, dispatch.Warnings())
+	assert.False(t, dispatch.FinalReceive(&sqs.Message{}), "no redrive policy")
+}
+
+func TestAutoConfigureWarnings(t *testing.T) {
+	sqsapi := fake.New(fake.Options{})
+	queue, err := sqsapi.CreateQueue(&sqs.CreateQueueInput{
+		QueueName:  aws.String("queue"),
+		Attributes: aws.StringMap(map[string]string{"VisibilityTimeout": "2"}),
+	})
+	assert.NoError(t, err)
+
+	logs := &records{}
+	dispatch := mustNew(t, Options{
+		SQS:           sqsapi,
+		AutoConfigure: true,
+		Logger:        logs,
+		Receive: ReceiveOptions{
+			RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: queue.QueueUrl},
+			FIFO:                true,
+		},
+		Delete: DeleteOptions{Interval: 5 * time.Second},
+	})
+
+	var fields []string
+	for _, warning := range dispatch.Warnings() {
+		assert.Equal(t, *queue.QueueUrl, warning.QueueURL)
+		fields = append(fields, warning.Field)
+	}
+
+	assert.Equal(t, []string{"Delete.Interval", "Receive.FIFO"}, fields)
+	assert.Len(t, logs.find("configuration warning"), 2)
+}
+
+func TestAutoConfigureQueues(t *testing.T) {
+	sqsapi := fake.New(fake.Options{})
+	high, err := sqsapi.CreateQueue(&sqs.CreateQueueInput{
+		QueueName: aws.String("high"),
+		Attributes: aws.StringMap(map[string]string{
+			"VisibilityTimeout":             "30",
+			"ReceiveMessageWaitTimeSeconds": "10",
+		}),
+	})
+	assert.NoError(t, err)
+	low, err := sqsapi.CreateQueue(&sqs.CreateQueueInput{
+		QueueName:  aws.String("low"),
+		Attributes: aws.StringMap(map[string]string{"VisibilityTimeout": "90"}),
+	})
+	assert.NoError(t, err)
+
+	dispatch := mustNew(t, Options{
+		SQS:           sqsapi,
+		AutoConfigure: true,
+		Receive: ReceiveOptions{
+			Queues: []Queue{{URL: high.QueueUrl}, {URL: low.QueueUrl}},
+		},
+		Heartbeat: HeartbeatOptions{Interval: 5 * time.Second},
+	})
+
+	assert.Equal(t, MaxLongPollDuration, dispatch.Options.Receive.waitTime(), "only derives options for a single queue")
+	assert.Equal(t, 30*time.Second, dispatch.Options.Heartbeat.VisibilityTimeout, "uses the shortest visibility timeout")
+	assert.Equal(t, 90*time.Second, dispatch.QueueAttributes(low.QueueUrl).VisibilityTimeout)
+}
+
+func TestAutoConfigureMissingQueue(t *testing.T) {
+	sqsapi := fake.New(fake.Options{})
+
+	_, err := New(context.Background(), Options{
+		SQS:           sqsapi,
+		AutoConfigure: true,
+		Receive: ReceiveOptions{
+			RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: aws.String("https://sqs.us-east-1.amazonaws.com/000000000000/missing")},
+		},
+	})
+
+	var attributesErr *QueueAttributesError
+	assert.True(t, errors.As(err, &attributesErr))
+	assert.Equal(t, "https://sqs.us-east-1.amazonaws.com/000000000000/missing", attributesErr.QueueURL)
+}
@@ -0,0 +1,39 @@
+package sqsch
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/bendrucker/sqs-receive-channel/pkg/receive"
+)
+
+// ApproximateReceiveCount is the name of the SQS system attribute that counts how many times a message has been received
+const ApproximateReceiveCount = "ApproximateReceiveCount"
+
+// BackoffPolicy returns how long a released message should remain invisible,
+// given the number of times it has been received
+type BackoffPolicy func(receiveCount int) time.Duration
+
+// ExponentialBackoff returns a BackoffPolicy that doubles the delay after each receive,
+// starting from base and capped at max, with full jitter applied.
+// For example, with base=1s the third receive is delayed by a random duration in [0s, 4s).
+func ExponentialBackoff(base, max time.Duration) BackoffPolicy {
+	if max <= 0 || max > MaxVisibilityTimeout {
+		max = MaxVisibilityTimeout
+	}
+
+	return BackoffPolicy(receive.ExponentialBackoff(base, max))
+}
+
+// ReceiveCount returns the ApproximateReceiveCount attribute of a message.
+// It returns 1 if the attribute was not requested or cannot be parsed.
+func ReceiveCount(message *sqs.Message) int {
+	count, err := strconv.Atoi(aws.StringValue(message.Attributes[ApproximateReceiveCount]))
+	if err != nil || count < 1 {
+		return 1
+	}
+
+	return count
+}
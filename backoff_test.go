@@ -0,0 +1,107 @@
+package sqsch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(time.Second, time.Minute)
+
+	cases := []struct {
+		count int
+		max   time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{3, 4 * time.Second},
+		{7, time.Minute},
+		{100, time.Minute},
+	}
+
+	for _, c := range cases {
+		for i := 0; i < 100; i++ {
+			delay := backoff(c.count)
+			assert.True(t, delay >= 0 && delay < c.max, "count=%d delay=%s", c.count, delay)
+		}
+	}
+}
+
+func TestExponentialBackoffMax(t *testing.T) {
+	backoff := ExponentialBackoff(time.Hour, 0)
+
+	for i := 0; i < 100; i++ {
+		assert.True(t, backoff(100) < MaxVisibilityTimeout)
+	}
+}
+
+func TestReceiveCount(t *testing.T) {
+	assert.Equal(t, 3, ReceiveCount(&sqs.Message{
+		Attributes: map[string]*string{ApproximateReceiveCount: aws.String("3")},
+	}))
+
+	assert.Equal(t, 1, ReceiveCount(&sqs.Message{}))
+}
+
+func TestReleaseBackoff(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl:       aws.String("http://foo.bar"),
+		AttributeNames: aws.StringSlice([]string{"SentTimestamp"}),
+	}
+
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), &sqs.ReceiveMessageInput{
+			QueueUrl:            input.QueueUrl,
+			WaitTimeSeconds:     aws.Int64(20),
+			MaxNumberOfMessages: aws.Int64(1),
+			AttributeNames:      aws.StringSlice([]string{"SentTimestamp", ApproximateReceiveCount}),
+		}).
+		DoAndReturn(func(ctx context.Context, _ *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}).
+		AnyTimes()
+
+	sqsapi.
+		EXPECT().
+		ChangeMessageVisibilityBatchWithContext(gomock.Any(), &sqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String("http://foo.bar"),
+			Entries: []*sqs.ChangeMessageVisibilityBatchRequestEntry{
+				{
+					Id:                aws.String("0"),
+					ReceiptHandle:     aws.String("handle"),
+					VisibilityTimeout: aws.Int64(30),
+				},
+			},
+		}).
+		Return(&sqs.ChangeMessageVisibilityBatchOutput{}, nil)
+
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: input},
+		Delete:  DeleteOptions{Interval: time.Hour},
+		Release: ReleaseOptions{
+			Backoff: func(count int) time.Duration {
+				return time.Duration(count) * 10 * time.Second
+			},
+		},
+	})
+
+	dispatch.Start(ctx)
+	dispatch.Releases() <- &Release{Message: &sqs.Message{
+		ReceiptHandle: aws.String("handle"),
+		Attributes:    map[string]*string{ApproximateReceiveCount: aws.String("3")},
+	}}
+
+	assert.NoError(t, dispatch.Shutdown(ctx))
+}
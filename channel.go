@@ -4,16 +4,18 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/bendrucker/sqs-receive-channel/pkg/batch"
 	"github.com/bendrucker/sqs-receive-channel/pkg/receive"
 
 	"github.com/aws/aws-sdk-go/aws"
 
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
-
-	"github.com/bendrucker/bach"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -26,6 +28,10 @@ const (
 	// https://docs.aws.amazon.com/AWSSimpleQueueService/latest/APIReference/API_ReceiveMessage.html
 	// https://docs.aws.amazon.com/AWSSimpleQueueService/latest/APIReference/API_DeleteMessageBatch.html
 	MaxBatchSize = 10
+
+	// MaxVisibilityTimeout is the maximum total time a received message can remain invisible
+	// https://docs.aws.amazon.com/AWSSimpleQueueService/latest/SQSDeveloperGuide/sqs-visibility-timeout.html
+	MaxVisibilityTimeout = 12 * time.Hour
 )
 
 // Dispatch provides methods for processing messages SQS via channels
@@ -34,13 +40,75 @@ type Dispatch struct {
 
 	receives chan *sqs.Message
 	deletes  chan *sqs.Message
+	releases chan *Release
+	changes  chan *visibilityChange
+	sends    chan *sqs.SendMessageInput
 	errors   chan error
+
+	leases   *leases
+	acks     *acks
+	claims   *claims
+	origins  *origins
+	attempts *attempts
+	groups   *groups
+	spans    *spans
+	inflight *inflight
+	dropped  int64
+	loop     loopState
+
+	attributes map[string]*QueueAttributes
+	warnings   []*ConfigurationWarning
+
+	stopReceive  context.CancelFunc
+	abortDeletes context.CancelFunc
+	receiveDone  <-chan struct{}
+	processDone  <-chan struct{}
+	// stopping is closed by Shutdown once input is no longer accepted
+	stopping chan struct{}
+	// stopped is closed once every goroutine has exited
+	stopped   chan struct{}
+	shutdown  sync.Once
+	receiving sync.WaitGroup
+	consumers sync.WaitGroup
+	changers  sync.WaitGroup
+	deleting  sync.WaitGroup
+	changing  sync.WaitGroup
+	sending   sync.WaitGroup
 }
 
 // Options represents the user-configurable options for a Dispatch
 type Options struct {
-	Receive ReceiveOptions
-	Delete  DeleteOptions
+	Receive    ReceiveOptions
+	Delete     DeleteOptions
+	Heartbeat  HeartbeatOptions
+	Release    ReleaseOptions
+	Serve      ServeOptions
+	Errors     ErrorOptions
+	Decode     DecodeOptions
+	Send       SendOptions
+	ClaimCheck ClaimCheckOptions
+
+	// AutoConfigure gets the attributes of each queue with GetQueueAttributes when the Dispatch
+	// is created. When receiving from a single queue, Receive.FIFO is set for a FIFO queue and
+	// the queue's wait time replaces the default. Heartbeats are never enabled, but if
+	// Heartbeat.Interval is set without Heartbeat.VisibilityTimeout, messages are extended by
+	// the queue's visibility timeout. Options that contradict the attributes are reported by
+	// Dispatch.Warnings.
+	AutoConfigure bool
+
+	// Metrics records instrumentation (default: NopMetrics)
+	Metrics Metrics
+	Tracing TracingOptions
+
+	// ShutdownTimeout limits how long a Dispatch takes to shut down gracefully after the
+	// context passed to Start or Serve is canceled. Serve includes the time it waits for
+	// running handlers to return (default: 30s)
+	ShutdownTimeout time.Duration
+
+	// Logger receives structured log records (default: NopLogger)
+	Logger Logger
+	// LogLevel is the lowest level that is logged (default: LogInfo)
+	LogLevel LogLevel
 
 	SQS sqsiface.SQSAPI
 }
@@ -49,25 +117,130 @@ type Options struct {
 func (o *Options) Defaults() {
 	o.Receive.Defaults()
 	o.Delete.Defaults()
+	o.Heartbeat.Defaults()
+	o.Send.Defaults()
+	o.Errors.Defaults()
+	o.Tracing.Defaults()
+
+	if o.Metrics == nil {
+		o.Metrics = NopMetrics{}
+	}
+
+	if o.Logger == nil {
+		o.Logger = NopLogger{}
+	}
+
+	if o.ShutdownTimeout == 0 {
+		o.ShutdownTimeout = 30 * time.Second
+	}
 }
 
 // ReceiveOptions configures receiving of messages from SQS
 type ReceiveOptions struct {
-	BufferSize          int
+	BufferSize int
+
+	// RecieveMessageInput sets the fields of each ReceiveMessage request. WaitTimeSeconds is
+	// how long each request waits for messages (default: MaxLongPollDuration, or the queue's
+	// wait time with Options.AutoConfigure), and 0 enables short polling. MaxNumberOfMessages
+	// limits the messages received per request (default: MaxBatchSize).
+	// ReceiveRequestAttemptId cannot be set because each request needs its own.
 	RecieveMessageInput *sqs.ReceiveMessageInput
+
+	// IdleInterval is how long to wait after a receive that returns no messages when short
+	// polling, to avoid spinning on an empty queue (default: 1s)
+	IdleInterval time.Duration
+
+	// QueueName is resolved to RecieveMessageInput.QueueUrl with GetQueueUrl when the
+	// Dispatch is created. It cannot be set along with QueueUrl.
+	QueueName string
+
+	// Workers registers idle workers. When set, messages are only received when a
+	// worker is waiting in this channel and are sent to that worker instead of the
+	// receive channel. Its capacity should be the desired concurrency.
+	Workers chan Worker
+
+	// UnwrapSNS replaces the body of each message with the message of its SNS notification
+	// envelope and adds the notification's message attributes, as if the subscription used
+	// raw message delivery. The topic, subject, message id, and timestamp of the notification
+	// are kept as system attributes and returned by SNS. Messages that are not valid
+	// notifications are reported as a *SNSEnvelopeError and released.
+	UnwrapSNS bool
+
+	// FIFO enables receiving from a FIFO queue. Failed receive requests are retried with the
+	// same ReceiveRequestAttemptId, and messages from the same message group are delivered
+	// in order, each one only after the previous one has been deleted. Releasing a message
+	// also releases the messages from its group that are waiting behind it.
+	FIFO bool
+
+	// Queues lists multiple queues to receive from instead of RecieveMessageInput.QueueUrl.
+	// The other fields of RecieveMessageInput apply to every queue. Each request is made to
+	// the first queue in Priority order that has messages available. When every queue is
+	// empty, only the first queue is long polled, so a message sent to another queue may wait
+	// up to WaitTimeSeconds to be received. Messages are deleted and released from the queue
+	// they were received from.
+	Queues   []Queue
+	Priority Priority
+
+	// ErrorBackoff is how long the receive loop waits after consecutive failed requests,
+	// instead of retrying immediately (default: receive.ExponentialBackoff(100ms, 30s))
+	ErrorBackoff receive.BackoffFunc
+	// Breaker stops receiving after Breaker.Threshold consecutive failed requests and probes
+	// the queue with a single request every Breaker.Cooldown until one succeeds. Each state
+	// change is logged and passed to Breaker.StateFunc.
+	Breaker receive.BreakerOptions
 }
 
+// Worker is a channel that an idle worker receives its next message from.
+// A worker registers itself by sending its channel to Receive.Workers:
+//
+//	work := make(chan *sqs.Message)
+//	for {
+//		workers <- work
+//		process(<-work)
+//	}
+type Worker chan<- *sqs.Message
+
 // Defaults sets default values
 func (ro *ReceiveOptions) Defaults() {
 	if ro.BufferSize == 0 {
 		ro.BufferSize = 1
 	}
+
+	if ro.RecieveMessageInput == nil {
+		ro.RecieveMessageInput = &sqs.ReceiveMessageInput{}
+	}
+
+	if ro.IdleInterval == 0 {
+		ro.IdleInterval = time.Duration(1) * time.Second
+	}
+}
+
+// waitTime returns how long each receive request waits for messages to be available
+func (ro *ReceiveOptions) waitTime() time.Duration {
+	if seconds := ro.RecieveMessageInput.WaitTimeSeconds; seconds != nil {
+		return time.Duration(*seconds) * time.Second
+	}
+
+	return MaxLongPollDuration
+}
+
+// maxMessages returns the most messages that are received per request
+func (ro *ReceiveOptions) maxMessages() int {
+	if max := ro.RecieveMessageInput.MaxNumberOfMessages; max != nil {
+		return int(*max)
+	}
+
+	return MaxBatchSize
 }
 
-// DeleteOptions configures deletion of messages from SQS
+// DeleteOptions configures deletion of messages from SQS.
+// Visibility changes are batched and processed using the same options.
 type DeleteOptions struct {
 	Interval    time.Duration
 	Concurrency int
+
+	// ResultFunc is called with the result of every delete
+	ResultFunc DeleteResultFunc
 }
 
 // Defaults sets default values
@@ -81,127 +254,519 @@ func (do *DeleteOptions) Defaults() {
 	}
 }
 
-// Start allocates channels, begins receiving, and begins processing deletes
+// ErrorFunc is called with errors that occur while processing messages.
+// It may be called concurrently from multiple goroutines.
+type ErrorFunc func(error)
+
+// ErrorOptions configures how errors are delivered.
+// By default, errors are sent to a buffered error channel and dropped if it is full,
+// so an application that stops reading errors never stalls receiving or deleting.
+type ErrorOptions struct {
+	// Handler is called with each error instead of sending it to the error channel.
+	// It is called synchronously and should not block.
+	Handler ErrorFunc
+	// BufferSize is the capacity of the error channel (default: 10, or 0 if Block is set)
+	BufferSize int
+	// Block waits for the error channel to be read instead of dropping errors when it is full
+	Block bool
+}
+
+// Defaults sets default values
+func (eo *ErrorOptions) Defaults() {
+	if eo.BufferSize == 0 && !eo.Block {
+		eo.BufferSize = 10
+	}
+}
+
+// Start allocates channels, begins receiving, and begins processing deletes.
+// Canceling ctx shuts down gracefully, flushing pending deletes within
+// Options.ShutdownTimeout. If New returns an error, it is sent to the errors channel,
+// which is then closed, and the receive channel is closed. Use New and Dispatch.Start
+// to handle the error directly.
 func Start(ctx context.Context, options Options) (
 	<-chan *sqs.Message,
 	chan<- *sqs.Message,
 	<-chan error,
 ) {
+	dispatch, err := New(ctx, options)
+	if err != nil {
+		receives := make(chan *sqs.Message)
+		close(receives)
+
+		errs := make(chan error, 1)
+		errs <- err
+		close(errs)
+
+		return receives, make(chan *sqs.Message, MaxBatchSize), errs
+	}
+
+	dispatch.Start(ctx)
+
+	return dispatch.receives, dispatch.deletes, dispatch.errors
+}
+
+// New validates options, resolves queue names to URLs, and allocates a Dispatch and its
+// channels without starting it. Invalid options are reported as a *ValidationError and
+// queue names that cannot be resolved as a *QueueNameError. If Options.AutoConfigure is set,
+// failures to get queue attributes are returned as a *QueueAttributesError. ctx is only used
+// for these requests.
+func New(ctx context.Context, options Options) (*Dispatch, error) {
+	heartbeat := options.Heartbeat
 	options.Defaults()
-	dispatch := Dispatch{
+
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := options.Receive.resolve(ctx, options.SQS); err != nil {
+		return nil, err
+	}
+
+	d := newDispatch(options)
+
+	if options.AutoConfigure {
+		if err := d.autoConfigure(ctx, heartbeat); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// newDispatch allocates a Dispatch with options that have defaults set
+func newDispatch(options Options) *Dispatch {
+	origins := newOrigins()
+
+	return &Dispatch{
 		Options:  options,
 		receives: make(chan *sqs.Message, options.Receive.BufferSize),
 		deletes:  make(chan *sqs.Message, MaxBatchSize),
-		errors:   make(chan error),
+		releases: make(chan *Release, MaxBatchSize),
+		changes:  make(chan *visibilityChange, MaxBatchSize),
+		sends:    make(chan *sqs.SendMessageInput, MaxBatchSize),
+		errors:   make(chan error, options.Errors.BufferSize),
+		leases:   newLeases(),
+		acks:     newAcks(),
+		claims:   newClaims(),
+		origins:  origins,
+		attempts: newAttempts(),
+		groups:   newGroups(origins),
+		spans:    newSpans(),
+		inflight: newInflight(),
+		stopping: make(chan struct{}),
+		stopped:  make(chan struct{}),
 	}
+}
 
-	dispatch.Receive(ctx)
-	dispatch.Delete(ctx)
+// Start begins receiving and processing deletes until Shutdown is called. Canceling ctx
+// shuts the Dispatch down like Shutdown, allowing Options.ShutdownTimeout for pending
+// deletes to be flushed.
+func (d *Dispatch) Start(ctx context.Context) {
+	receiveCtx, stopReceive := context.WithCancel(ctx)
+	processCtx, abort := context.WithCancel(detach(ctx))
+	d.stopReceive, d.abortDeletes = stopReceive, abort
+	d.receiveDone = receiveCtx.Done()
+	d.processDone = processCtx.Done()
 
-	return dispatch.receives, dispatch.deletes, dispatch.errors
+	d.Receive(receiveCtx)
+	d.Heartbeat(processCtx)
+	d.Delete(processCtx)
+	d.Release(processCtx)
+	d.ChangeVisibility(processCtx)
+	d.Send(processCtx)
+
+	go func() {
+		d.receiving.Wait()
+		close(d.receives)
+
+		d.changers.Wait()
+		close(d.changes)
+
+		d.deleting.Wait()
+		d.changing.Wait()
+		d.sending.Wait()
+		close(d.errors)
+
+		stopReceive()
+		abort()
+		close(d.stopped)
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(detach(ctx), d.Options.ShutdownTimeout)
+			defer cancel()
+
+			d.Shutdown(shutdownCtx)
+		case <-d.stopped:
+		}
+	}()
+}
+
+// Receives returns the channel that received messages are sent to
+func (d *Dispatch) Receives() <-chan *sqs.Message {
+	return d.receives
+}
+
+// Deletes returns the channel that accepts messages to be deleted
+func (d *Dispatch) Deletes() chan<- *sqs.Message {
+	return d.deletes
+}
+
+// Releases returns the channel that accepts messages to be returned to the queue
+func (d *Dispatch) Releases() chan<- *Release {
+	return d.releases
+}
+
+// Errors returns the channel that receive and delete errors are sent to.
+// Nothing is sent to it if Errors.Handler is set.
+func (d *Dispatch) Errors() <-chan error {
+	return d.errors
+}
+
+// DroppedErrors returns the number of errors that were dropped because the error channel was full
+func (d *Dispatch) DroppedErrors() int64 {
+	return atomic.LoadInt64(&d.dropped)
 }
 
-// QueueURL returns the SQS Queue URL specified with Options.Receive.ReceiveMessageInput
+// QueueURL returns the SQS Queue URL specified with Options.Receive.ReceiveMessageInput,
+// or the URL of the first of Options.Receive.Queues if it is not set
 func (d *Dispatch) QueueURL() *string {
-	return d.Options.Receive.RecieveMessageInput.QueueUrl
+	if input := d.Options.Receive.RecieveMessageInput; input != nil && input.QueueUrl != nil {
+		return input.QueueUrl
+	}
+
+	if len(d.Options.Receive.Queues) == 0 {
+		return nil
+	}
+
+	return d.Options.Receive.Queues[0].URL
 }
 
-// ReceiveCapacity returns the available space in the receive channel's buffer.
+// ReceiveCapacity returns the number of messages that can be received.
 // This is used to determine how many ReceiveMessage requests to issue and how
 // many messages (count) are requested in each.
+//
+// By default this is the available space in the receive channel's buffer, so the
+// application fetches eagerly. This is ok for lower throughput applications and
+// inexpensive tasks where the visibility timeout is ~10x the expected time to processing.
+// But given a 30s CPU-intensive job w/ a 60s timeout, the application would start
+// buffering messages for ~30s before even starting work on them, resulting in lots
+// of timeouts. When Receive.Workers is set, the capacity is the number of idle
+// workers instead, so messages are only fetched when a worker is ready for them.
 func (d *Dispatch) ReceiveCapacity() int {
-	// TODO: This should be user specifiable and based on a different channel buffer
-	// An implementer will have workers:
-	// func worker(workers chan<- Worker, work <-chan Work) {
-	// 		workers <- Worker{work}
-	// 		doWork(<-work)
-	// }
-	//
-	// workers should be a buffered channel with cap set to the desired concurrency
-	// CountFunc should return len(workers)—the number of workers that have
-	// have not been assigned by the dispatcher by reading them from the channel
-	// and writing to their work channel
-	//
-	// Using the size of the receive buffer, the application will fetch eagerly.
-	// This is ok for lower throughput applications and inexpensive tasks where
-	// the visibility timeout is ~10x the expected time to processing.
-	//
-	// But given a 30s CPU-intensive job w/ a 60s timeout, the application would
-	// start buffering messages for ~30s before even starting work on them, resulting
-	// in lots of timeouts.
+	if d.Options.Receive.Workers != nil {
+		return len(d.Options.Receive.Workers)
+	}
+
 	return cap(d.receives) - len(d.receives)
 }
 
 // Receive runs a loop that receives messages from SQS until the supplied context is canceled.
-// It checks for available space on the receive channel's buffer.
-// It fetches up to that number of messages from SQS and sends them to the receive channel.
+// It checks for available space on the receive channel's buffer (or idle workers).
+// It fetches up to that number of messages from SQS and sends them to the receive channel,
+// or directly to an idle worker if Receive.Workers is set.
 // If the receive buffer is full, it continues looping until capacity is detected.
 // Because SQS bills per API request, ReceiveMessageInput.WaitTimeSeconds allows the loop to block
 // for up to 20 seconds if no messages are available to receive which results in ~3 requests per minute
-// instead of hundreds when your queue is idle.
+// instead of hundreds when your queue is idle. When short polling, the loop waits for Receive.IdleInterval
+// after each empty receive instead.
 func (d *Dispatch) Receive(ctx context.Context) {
+	breaker := d.Options.Receive.Breaker
+	breaker.StateFunc = func(from, to receive.State) {
+		d.logBreaker(ctx, from, to)
+
+		if fn := d.Options.Receive.Breaker.StateFunc; fn != nil {
+			fn(from, to)
+		}
+	}
+
 	receive := receive.New(receive.Options{
-		MaxCount:  MaxBatchSize,
-		CountFunc: d.ReceiveCapacity,
+		MaxCount: d.Options.Receive.maxMessages(),
+		Backoff:  d.Options.Receive.ErrorBackoff,
+		Breaker:  breaker,
+		CountFunc: func() int {
+			d.Options.Metrics.ReceiveBuffer(len(d.receives), cap(d.receives))
+			capacity := d.ReceiveCapacity()
+			d.logCapacity(ctx, capacity)
+			return capacity
+		},
 		DoFunc: func(count receive.Request) ([]interface{}, error) {
 			return d.doReceive(ctx, count)
 		},
 	})
 
 	receive.Start(ctx)
+	d.receiving.Add(2)
+	d.log(ctx, LogInfo, "receive started", d.QueueURL())
 
 	go func() {
-		for message := range receive.Results() {
-			d.receives <- message.(*sqs.Message)
+		defer d.receiving.Done()
+		results := receive.Results()
+
+		for {
+			select {
+			case result, ok := <-results:
+				if !ok {
+					for _, message := range d.groups.drain() {
+						d.requeue(message)
+					}
+
+					d.log(ctx, LogInfo, "receive stopped", d.QueueURL())
+					return
+				}
+
+				d.forward(ctx, result.(*received))
+			case <-d.groups.signal:
+				for message := d.groups.next(); message != nil; message = d.groups.next() {
+					d.deliver(ctx, message)
+				}
+			}
 		}
 	}()
 
 	go func() {
+		defer d.receiving.Done()
+
 		for err := range receive.Errors() {
-			d.errors <- err
+			d.error(ctx, err)
 		}
 	}()
 }
 
+// forward delivers a received message, unless it must wait for another message from
+// the same FIFO message group. Messages that could not be prepared are released.
+func (d *Dispatch) forward(ctx context.Context, r *received) {
+	message, err := r.message, r.err
+
+	d.inflight.add(message)
+	d.track(message)
+	d.startProcessing(message)
+
+	// messages that could not be prepared still join their group, so that messages
+	// received after them are released with them instead of being delivered first
+	acquired := !d.Options.Receive.FIFO || d.groups.acquire(message)
+
+	if err != nil {
+		d.endProcessing(message, err)
+
+		if ctx.Err() == nil {
+			d.error(ctx, err)
+		}
+
+		d.requeue(message)
+		return
+	}
+
+	if !acquired {
+		return
+	}
+
+	d.deliver(ctx, message)
+}
+
+// deliver dispatches a message and requeues it if it could not be delivered
+func (d *Dispatch) deliver(ctx context.Context, message *sqs.Message) {
+	if !d.dispatch(ctx, message) {
+		d.requeue(message)
+	}
+}
+
+// dispatch sends a received message to the receive channel or to the next idle worker.
+// It returns false if ctx is done before the message could be delivered.
+func (d *Dispatch) dispatch(ctx context.Context, message *sqs.Message) bool {
+	var receives chan<- *sqs.Message = d.receives
+
+	if d.Options.Receive.Workers != nil {
+		select {
+		case worker := <-d.Options.Receive.Workers:
+			receives = worker
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	select {
+	case receives <- message:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
 func (d *Dispatch) doReceive(ctx context.Context, count receive.Request) ([]interface{}, error) {
 	messages, err := d.receiveMessages(ctx, int(count))
 
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+
 		return nil, err
 	}
 
-	return wrapMessages(messages), nil
+	if len(messages) == 0 && d.Options.Receive.waitTime() == 0 {
+		timer := time.NewTimer(d.Options.Receive.IdleInterval)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+
+	return d.prepare(ctx, messages), nil
 }
 
-func wrapMessages(messages []*sqs.Message) []interface{} {
+// received is a received message and the error from preparing it, if any
+type received struct {
+	message *sqs.Message
+	err     error
+}
+
+// prepare unwraps SNS notifications and resolves claim checks. Payloads are fetched
+// concurrently so that a slow BlobStore does not hold up the rest of the messages.
+// Messages are only received when there is capacity for them, which bounds the number
+// of concurrent fetches.
+func (d *Dispatch) prepare(ctx context.Context, messages []*sqs.Message) []interface{} {
 	results := make([]interface{}, len(messages))
+	var wg sync.WaitGroup
 
 	for i, message := range messages {
-		results[i] = message
+		r := &received{message: message, err: d.unwrap(message)}
+		results[i] = r
+
+		if r.err != nil || !d.Options.ClaimCheck.Enabled() {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.err = d.resolve(ctx, r.message)
+		}()
 	}
 
+	wg.Wait()
 	return results
 }
 
+// receiveMessages receives up to count messages. With multiple queues, each queue is short
+// polled in order and the first queue is long polled if all of them are empty. Long polling
+// every queue at once would require abandoning the requests that lose, and messages they
+// received would stay invisible until their visibility timeout.
 func (d *Dispatch) receiveMessages(ctx context.Context, count int) ([]*sqs.Message, error) {
+	if len(d.Options.Receive.Queues) == 0 {
+		return d.receiveQueue(ctx, d.QueueURL(), count, d.Options.Receive.waitTime())
+	}
+
+	var first error
+	urls := d.Options.Receive.order()
+
+	for _, url := range urls {
+		messages, err := d.receiveQueue(ctx, url, count, 0)
+
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+
+			continue
+		}
+
+		if len(messages) > 0 {
+			return messages, nil
+		}
+	}
+
+	if first != nil {
+		return nil, first
+	}
+
+	return d.receiveQueue(ctx, urls[0], count, d.Options.Receive.waitTime())
+}
+
+// receiveQueue receives up to count messages from a queue, waiting up to wait for messages to be available
+func (d *Dispatch) receiveQueue(ctx context.Context, url *string, count int, wait time.Duration) ([]*sqs.Message, error) {
 	input := d.Options.Receive.RecieveMessageInput
-	output, err := d.Options.SQS.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+	request := &sqs.ReceiveMessageInput{
 		MaxNumberOfMessages: aws.Int64(int64(count)),
-		WaitTimeSeconds:     aws.Int64(int64(MaxLongPollDuration.Seconds())),
-		QueueUrl:            d.QueueURL(),
+		WaitTimeSeconds:     aws.Int64(int64(wait.Seconds())),
+		QueueUrl:            url,
 
-		AttributeNames:        input.AttributeNames,
-		MessageAttributeNames: input.MessageAttributeNames,
+		AttributeNames:        d.attributeNames(),
+		MessageAttributeNames: d.messageAttributeNames(),
 		VisibilityTimeout:     input.VisibilityTimeout,
-	})
+	}
+
+	var attempt attempt
+	if d.Options.Receive.FIFO {
+		attempt = d.attempts.next(aws.StringValue(url), time.Now())
+		request.ReceiveRequestAttemptId = aws.String(attempt.id)
+	}
+
+	ctx, span := d.startRequest(ctx, "ReceiveMessage", url)
+	start := time.Now()
+	output, err := d.Options.SQS.ReceiveMessageWithContext(ctx, request)
+	d.observe("ReceiveMessage", start, err)
+	endSpan(span, err)
 
 	if err != nil {
+		if ctx.Err() == nil {
+			d.logReceive(ctx, url, 0, err)
+
+			if d.Options.Receive.FIFO {
+				d.attempts.retry(attempt)
+			}
+		}
+
 		return nil, err
 	}
 
+	d.Options.Metrics.Received(len(output.Messages))
+	d.logReceive(ctx, url, len(output.Messages), nil)
+
+	if len(d.Options.Receive.Queues) > 0 {
+		for _, message := range output.Messages {
+			d.origins.add(message, url)
+		}
+	}
+
 	return output.Messages, nil
 }
 
+// attributeNames returns the AttributeNames specified with Options.Receive.ReceiveMessageInput,
+// adding any system attributes that are required by other options
+func (d *Dispatch) attributeNames() []*string {
+	names := d.Options.Receive.RecieveMessageInput.AttributeNames
+
+	if d.Options.Release.Backoff != nil || d.redrive() {
+		names = withAttributeName(names, ApproximateReceiveCount)
+	}
+
+	if d.Options.Receive.FIFO {
+		names = withAttributeName(names, MessageGroupId)
+		names = withAttributeName(names, SequenceNumber)
+	}
+
+	if d.Options.Tracing.Enabled() {
+		names = withAttributeName(names, AWSTraceHeader)
+	}
+
+	return names
+}
+
+func withAttributeName(names []*string, name string) []*string {
+	for _, n := range names {
+		if v := aws.StringValue(n); v == name || v == sqs.QueueAttributeNameAll {
+			return names
+		}
+	}
+
+	return append(append([]*string{}, names...), aws.String(name))
+}
+
 // BatchDeleteError represents an error returned from SQS in response to a DeleteMessageBatch request
 type BatchDeleteError struct {
 	Code          string
@@ -213,67 +778,249 @@ func (err *BatchDeleteError) Error() string {
 	return fmt.Sprintf("SQS batch delete error: %s (%s)", err.Message, err.Code)
 }
 
-// Delete processes messages received on the delete channel until the supplied context is canceled.
-// It batching messages with BatchDeletes and calls the SQS DeleteMessageBatch API to trigger deletion.
+// DeleteResult reports the outcome of deleting a message.
+// Err is nil if the message was deleted. Otherwise it is a *BatchDeleteError
+// or the error returned by the DeleteMessageBatch request.
+type DeleteResult struct {
+	Message *sqs.Message
+	Err     error
+}
+
+// DeleteResultFunc is called with the result of every message sent to the delete channel.
+// It may be called concurrently from multiple goroutines.
+type DeleteResultFunc func(*DeleteResult)
+
+// Delete processes messages received on the delete channel until Shutdown stops accepting
+// input or the supplied context is canceled.
+// It batches messages like BatchDeletes and calls the SQS DeleteMessageBatch API to trigger deletion.
 // If there are failures in the DeleteMessageBatchOutput, it sends one error per failure to the errors channel.
+// If Delete.ResultFunc is set, it is called with the result of each message.
 func (d *Dispatch) Delete(ctx context.Context) {
-	batches := d.BatchDeletes(d.deletes)
+	batches := d.batchDeletes(ctx, d.deletes)
 
 	for i := 0; i < d.Options.Delete.Concurrency; i++ {
+		d.deleting.Add(1)
+
 		go func() {
+			defer d.deleting.Done()
+
 			for {
 				select {
 				case <-ctx.Done():
 					return
-				case entries := <-batches:
-					output, err := d.Options.SQS.DeleteMessageBatchWithContext(ctx, &sqs.DeleteMessageBatchInput{
-						Entries:  entries,
-						QueueUrl: d.QueueURL(),
-					})
-
-					if err != nil {
-						d.errors <- err
-						continue
+				case messages, ok := <-batches:
+					if !ok {
+						return
 					}
 
-					for i, failure := range output.Failed {
-						d.errors <- &BatchDeleteError{
-							Code:          *failure.Code,
-							Message:       *failure.Message,
-							ReceiptHandle: *entries[i].ReceiptHandle,
-						}
-					}
+					d.deleteBatch(ctx, messages)
 				}
 			}
 		}()
 	}
 }
 
+func (d *Dispatch) deleteBatch(ctx context.Context, messages []*sqs.Message) {
+	errs := make([]error, len(messages))
+	urls, indexes := d.byQueue(messages)
+
+	for _, url := range urls {
+		d.deleteQueueBatch(ctx, url, messages, indexes[aws.StringValue(url)], errs)
+	}
+
+	for i, message := range messages {
+		d.origins.remove(message)
+
+		if errs[i] == nil {
+			d.deleteBlob(ctx, message)
+		} else {
+			d.claims.remove(message)
+			d.Options.Metrics.DeleteFailed(errorCode(errs[i]))
+		}
+
+		d.endProcessing(message, errs[i])
+		d.acks.done(message, errs[i])
+
+		if d.Options.Delete.ResultFunc != nil {
+			d.Options.Delete.ResultFunc(&DeleteResult{Message: message, Err: errs[i]})
+		}
+	}
+}
+
+// deleteQueueBatch deletes the messages at indexes from the queue at url and sets
+// the error for each message that was not deleted in errs
+func (d *Dispatch) deleteQueueBatch(ctx context.Context, url *string, messages []*sqs.Message, indexes []int, errs []error) {
+	entries := make([]*sqs.DeleteMessageBatchRequestEntry, len(indexes))
+
+	for j, i := range indexes {
+		entries[j] = &sqs.DeleteMessageBatchRequestEntry{
+			Id:            aws.String(strconv.Itoa(i)),
+			ReceiptHandle: messages[i].ReceiptHandle,
+		}
+	}
+
+	ctx, span := d.startRequest(ctx, "DeleteMessageBatch", url)
+	span.SetAttributes(attribute.Int("messaging.batch.message_count", len(entries)))
+	start := time.Now()
+	output, err := d.Options.SQS.DeleteMessageBatchWithContext(ctx, &sqs.DeleteMessageBatchInput{
+		Entries:  entries,
+		QueueUrl: url,
+	})
+	d.observe("DeleteMessageBatch", start, err)
+	endSpan(span, err)
+
+	if err != nil {
+		d.log(ctx, LogError, "delete batch failed", url, LogKeyCount, len(entries), LogKeyError, err)
+		d.error(ctx, err)
+
+		for _, i := range indexes {
+			errs[i] = err
+		}
+
+		return
+	}
+
+	for _, failure := range output.Failed {
+		i, err := strconv.Atoi(aws.StringValue(failure.Id))
+		if err != nil || i < 0 || i >= len(messages) {
+			continue
+		}
+
+		errs[i] = &BatchDeleteError{
+			Code:          aws.StringValue(failure.Code),
+			Message:       aws.StringValue(failure.Message),
+			ReceiptHandle: aws.StringValue(messages[i].ReceiptHandle),
+		}
+
+		d.log(ctx, LogWarn, "delete failed", url,
+			LogKeyMessageID, aws.StringValue(messages[i].MessageId),
+			LogKeyCode, aws.StringValue(failure.Code),
+			LogKeyError, aws.StringValue(failure.Message),
+		)
+		d.error(ctx, errs[i])
+	}
+
+	d.log(ctx, LogDebug, "deleted messages", url, LogKeyCount, len(entries)-len(output.Failed))
+}
+
+// error delivers err according to the ErrorOptions. If blocking is enabled,
+// it waits to send err to the errors channel unless ctx is done first.
+func (d *Dispatch) error(ctx context.Context, err error) {
+	switch {
+	case d.Options.Errors.Handler != nil:
+		d.Options.Errors.Handler(err)
+	case d.Options.Errors.Block:
+		select {
+		case d.errors <- err:
+		case <-ctx.Done():
+		}
+	default:
+		select {
+		case d.errors <- err:
+		default:
+			atomic.AddInt64(&d.dropped, 1)
+		}
+	}
+}
+
 // BatchDeletes buffers messages received on the delete channel,
-// batching according to the Delete.Interval and the MaxBatchSize
+// batching according to the Delete.Interval and the MaxBatchSize.
+// Each entry's Id is its index within the batch.
+// When the delete channel is closed, pending messages are flushed and the
+// returned channel is closed.
 func (d *Dispatch) BatchDeletes(deletes <-chan *sqs.Message) <-chan []*sqs.DeleteMessageBatchRequestEntry {
+	batches := d.batchDeletes(context.Background(), deletes)
+	output := make(chan []*sqs.DeleteMessageBatchRequestEntry)
+
+	go func() {
+		defer close(output)
+
+		for messages := range batches {
+			entries := make([]*sqs.DeleteMessageBatchRequestEntry, len(messages))
+
+			for i, message := range messages {
+				entries[i] = &sqs.DeleteMessageBatchRequestEntry{
+					Id:            aws.String(strconv.Itoa(i)),
+					ReceiptHandle: message.ReceiptHandle,
+				}
+			}
+
+			output <- entries
+		}
+	}()
+
+	return output
+}
+
+// batchDeletes batches messages from deletes until it is closed or Shutdown stops accepting
+// input, at which point messages already sent are flushed. If ctx is canceled, pending
+// messages are abandoned.
+func (d *Dispatch) batchDeletes(ctx context.Context, deletes <-chan *sqs.Message) <-chan []*sqs.Message {
 	input := make(chan interface{})
 	go func() {
-		for m := range deletes {
-			input <- m
+		defer close(input)
+
+		accept := func(m *sqs.Message) bool {
+			d.leases.remove(m)
+			d.groups.done(m)
+			d.inflight.remove(m)
+
+			select {
+			case input <- m:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for {
+			select {
+			case m, ok := <-deletes:
+				if !ok || !accept(m) {
+					return
+				}
+			case <-d.stopping:
+				for {
+					select {
+					case m := <-deletes:
+						if !accept(m) {
+							return
+						}
+					default:
+						return
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 
-	batches := bach.NewBatch(input, MaxBatchSize, d.Options.Delete.Interval)
-	output := make(chan []*sqs.DeleteMessageBatchRequestEntry)
+	batches := batch.NewWithOptions(input, batch.Options{
+		Size:     MaxBatchSize,
+		Interval: d.Options.Delete.Interval,
+		FlushFunc: func(size int, reason batch.Reason) {
+			d.Options.Metrics.DeleteBatch(size, reason)
+			d.log(ctx, LogDebug, "delete batch flushed", d.QueueURL(), LogKeyCount, size, LogKeyReason, reason.String())
+		},
+	})
+	output := make(chan []*sqs.Message)
 
 	go func() {
+		defer close(output)
+
+		// batches are discarded once ctx is canceled, until the batcher exits
 		for batch := range batches {
-			entries := make([]*sqs.DeleteMessageBatchRequestEntry, len(batch))
+			messages := make([]*sqs.Message, len(batch))
 
 			for i, message := range batch {
-				entries[i] = &sqs.DeleteMessageBatchRequestEntry{
-					Id:            aws.String(strconv.Itoa(i)),
-					ReceiptHandle: message.(*sqs.Message).ReceiptHandle,
-				}
+				messages[i] = message.(*sqs.Message)
 			}
 
-			output <- entries
+			select {
+			case output <- messages:
+			case <-ctx.Done():
+			}
 		}
 	}()
 
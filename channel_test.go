@@ -3,13 +3,17 @@ package sqsch
 import (
 	"context"
 	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/bendrucker/sqs-receive-channel/fake"
 	"github.com/bendrucker/sqs-receive-channel/mock"
+	"github.com/bendrucker/sqs-receive-channel/pkg/receive"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 )
@@ -17,8 +21,77 @@ import (
 func setup(t *testing.T) (context.Context, *mock.MockSQSAPI, func()) {
 	ctrl := gomock.NewController(t)
 	sqsapi := mock.NewMockSQSAPI(ctrl)
-	ctx := context.TODO()
-	return ctx, sqsapi, ctrl.Finish
+	ctx, cancel := context.WithCancel(context.TODO())
+	return ctx, sqsapi, func() {
+		cancel()
+		ctrl.Finish()
+	}
+}
+
+// blockReceives expects any number of ReceiveMessage requests, each of which blocks
+// until its context is canceled
+func blockReceives(sqsapi *mock.MockSQSAPI) {
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _ *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}).
+		AnyTimes()
+}
+
+// mustNew creates a Dispatch and fails the test if New returns an error.
+// If the Dispatch is started, it is shut down when the test completes so that
+// no requests are made after the test's mocks are finished.
+func mustNew(t *testing.T, options Options) *Dispatch {
+	t.Helper()
+
+	dispatch, err := New(context.Background(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if dispatch.processDone == nil {
+			return
+		}
+
+		// tests may not delete or release every message they receive
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		dispatch.Shutdown(ctx)
+	})
+
+	return dispatch
+}
+
+// mustStart starts a Dispatch and fails the test if New returns an error
+func mustStart(t *testing.T, ctx context.Context, options Options) (<-chan *sqs.Message, chan<- *sqs.Message, <-chan error) {
+	t.Helper()
+
+	dispatch := mustNew(t, options)
+	dispatch.Start(ctx)
+
+	return dispatch.receives, dispatch.deletes, dispatch.errors
+}
+
+// expectReleases allows any number of ChangeMessageVisibilityBatch requests, which release
+// messages that are still buffered when a Dispatch shuts down
+func expectReleases(sqsapi *mock.MockSQSAPI) {
+	sqsapi.
+		EXPECT().
+		ChangeMessageVisibilityBatchWithContext(gomock.Any(), gomock.Any()).
+		Return(&sqs.ChangeMessageVisibilityBatchOutput{}, nil).
+		AnyTimes()
+}
+
+// newUnvalidated sets defaults and allocates a Dispatch without validating options,
+// for tests of internals that do not need every option
+func newUnvalidated(options Options) *Dispatch {
+	options.Defaults()
+	return newDispatch(options)
 }
 
 func TestReceive(t *testing.T) {
@@ -31,7 +104,7 @@ func TestReceive(t *testing.T) {
 
 	sqsapi.
 		EXPECT().
-		ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		ReceiveMessageWithContext(gomock.Any(), &sqs.ReceiveMessageInput{
 			QueueUrl:            input.QueueUrl,
 			WaitTimeSeconds:     aws.Int64(20),
 			MaxNumberOfMessages: aws.Int64(1),
@@ -43,7 +116,9 @@ func TestReceive(t *testing.T) {
 		}, nil).
 		AnyTimes()
 
-	receive, _, _ := Start(ctx, Options{
+	expectReleases(sqsapi)
+
+	receive, _, _ := mustStart(t, ctx, Options{
 		SQS:     sqsapi,
 		Receive: ReceiveOptions{RecieveMessageInput: input},
 	})
@@ -52,6 +127,84 @@ func TestReceive(t *testing.T) {
 	assert.Equal(t, "hello world", aws.StringValue(message.Body))
 }
 
+func TestReceiveInput(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String("http://foo.bar"),
+		WaitTimeSeconds:     aws.Int64(5),
+		MaxNumberOfMessages: aws.Int64(2),
+		VisibilityTimeout:   aws.Int64(30),
+	}
+
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), &sqs.ReceiveMessageInput{
+			QueueUrl:            input.QueueUrl,
+			WaitTimeSeconds:     aws.Int64(5),
+			MaxNumberOfMessages: aws.Int64(2),
+			VisibilityTimeout:   aws.Int64(30),
+		}).
+		Return(&sqs.ReceiveMessageOutput{
+			Messages: []*sqs.Message{{
+				Body: aws.String("hello world"),
+			}},
+		}, nil)
+
+	// later requests are sized by the remaining capacity
+	blockReceives(sqsapi)
+
+	receive, _, _ := mustStart(t, ctx, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: input, BufferSize: 10},
+	})
+
+	message := <-receive
+	assert.Equal(t, "hello world", aws.StringValue(message.Body))
+}
+
+func TestReceiveShortPoll(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl:        aws.String("http://foo.bar"),
+		WaitTimeSeconds: aws.Int64(0),
+	}
+
+	calls := make(chan time.Time, 10)
+
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), &sqs.ReceiveMessageInput{
+			QueueUrl:            input.QueueUrl,
+			WaitTimeSeconds:     aws.Int64(0),
+			MaxNumberOfMessages: aws.Int64(1),
+		}).
+		DoAndReturn(func(_ context.Context, _ *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+			select {
+			case calls <- time.Now():
+			default:
+			}
+
+			return &sqs.ReceiveMessageOutput{}, nil
+		}).
+		AnyTimes()
+
+	mustStart(t, ctx, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: input, IdleInterval: 50 * time.Millisecond},
+	})
+
+	previous := <-calls
+	for i := 0; i < 3; i++ {
+		call := <-calls
+		assert.True(t, call.Sub(previous) >= 50*time.Millisecond, "waits for IdleInterval after each empty receive")
+		previous = call
+	}
+}
+
 func TestDelete(t *testing.T) {
 	ctx, sqsapi, finish := setup(t)
 	defer finish()
@@ -69,7 +222,7 @@ func TestDelete(t *testing.T) {
 
 	sqsapi.
 		EXPECT().
-		ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		ReceiveMessageWithContext(gomock.Any(), &sqs.ReceiveMessageInput{
 			QueueUrl:            input.QueueUrl,
 			WaitTimeSeconds:     aws.Int64(20),
 			MaxNumberOfMessages: aws.Int64(1),
@@ -81,7 +234,7 @@ func TestDelete(t *testing.T) {
 
 	sqsapi.
 		EXPECT().
-		DeleteMessageBatchWithContext(ctx, &sqs.DeleteMessageBatchInput{
+		DeleteMessageBatchWithContext(gomock.Any(), &sqs.DeleteMessageBatchInput{
 			QueueUrl: aws.String("http://foo.bar"),
 			Entries: []*sqs.DeleteMessageBatchRequestEntry{
 				{
@@ -102,7 +255,7 @@ func TestDelete(t *testing.T) {
 			cancel()
 		})
 
-	_, delete, _ := Start(ctx, Options{
+	_, delete, _ := mustStart(t, ctx, Options{
 		SQS:     sqsapi,
 		Receive: ReceiveOptions{RecieveMessageInput: input},
 		Delete:  DeleteOptions{Interval: time.Duration(100)},
@@ -112,6 +265,25 @@ func TestDelete(t *testing.T) {
 	<-ctx.Done()
 }
 
+func TestBatchDeletes(t *testing.T) {
+	dispatch := newUnvalidated(Options{Delete: DeleteOptions{Interval: time.Hour}})
+
+	deletes := make(chan *sqs.Message, 2)
+	deletes <- &sqs.Message{ReceiptHandle: aws.String("a")}
+	deletes <- &sqs.Message{ReceiptHandle: aws.String("b")}
+	close(deletes)
+
+	batches := dispatch.BatchDeletes(deletes)
+
+	assert.Equal(t, []*sqs.DeleteMessageBatchRequestEntry{
+		{Id: aws.String("0"), ReceiptHandle: aws.String("a")},
+		{Id: aws.String("1"), ReceiptHandle: aws.String("b")},
+	}, <-batches)
+
+	_, ok := <-batches
+	assert.False(t, ok)
+}
+
 func TestReceiveError(t *testing.T) {
 	ctx, sqsapi, finish := setup(t)
 	defer finish()
@@ -122,7 +294,7 @@ func TestReceiveError(t *testing.T) {
 
 	sqsapi.
 		EXPECT().
-		ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		ReceiveMessageWithContext(gomock.Any(), &sqs.ReceiveMessageInput{
 			QueueUrl:            input.QueueUrl,
 			WaitTimeSeconds:     aws.Int64(20),
 			MaxNumberOfMessages: aws.Int64(1),
@@ -130,7 +302,7 @@ func TestReceiveError(t *testing.T) {
 		Return(nil, errors.New("SQS error")).
 		AnyTimes()
 
-	_, _, errs := Start(ctx, Options{
+	_, _, errs := mustStart(t, ctx, Options{
 		SQS:     sqsapi,
 		Receive: ReceiveOptions{RecieveMessageInput: input},
 	})
@@ -139,6 +311,54 @@ func TestReceiveError(t *testing.T) {
 	assert.EqualError(t, err, "SQS error")
 }
 
+func TestReceiveBreaker(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl: aws.String("http://foo.bar"),
+	}
+
+	var calls int32
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+			atomic.AddInt32(&calls, 1)
+			return nil, errors.New("SQS error")
+		}).
+		AnyTimes()
+
+	states := make(chan receive.State, 10)
+	logs := &records{}
+
+	mustStart(t, ctx, Options{
+		SQS:    sqsapi,
+		Logger: logs,
+		Receive: ReceiveOptions{
+			RecieveMessageInput: input,
+			ErrorBackoff: func(failures int) time.Duration {
+				return 0
+			},
+			Breaker: receive.BreakerOptions{
+				Threshold: 2,
+				Cooldown:  time.Minute,
+				StateFunc: func(from, to receive.State) {
+					states <- to
+				},
+			},
+		},
+	})
+
+	assert.Equal(t, receive.StateOpen, <-states)
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "stops receiving while open")
+	if found := logs.find("receive circuit open"); assert.Len(t, found, 1) {
+		assert.Equal(t, LogWarn, found[0].level)
+	}
+}
+
 func TestDeleteError(t *testing.T) {
 	ctx, sqsapi, finish := setup(t)
 	defer finish()
@@ -154,7 +374,7 @@ func TestDeleteError(t *testing.T) {
 
 	sqsapi.
 		EXPECT().
-		ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		ReceiveMessageWithContext(gomock.Any(), &sqs.ReceiveMessageInput{
 			QueueUrl:            input.QueueUrl,
 			WaitTimeSeconds:     aws.Int64(20),
 			MaxNumberOfMessages: aws.Int64(1),
@@ -166,7 +386,7 @@ func TestDeleteError(t *testing.T) {
 
 	sqsapi.
 		EXPECT().
-		DeleteMessageBatchWithContext(ctx, &sqs.DeleteMessageBatchInput{
+		DeleteMessageBatchWithContext(gomock.Any(), &sqs.DeleteMessageBatchInput{
 			QueueUrl: aws.String("http://foo.bar"),
 			Entries: []*sqs.DeleteMessageBatchRequestEntry{
 				{
@@ -177,7 +397,7 @@ func TestDeleteError(t *testing.T) {
 		}).
 		Return(nil, errors.New("SQS error"))
 
-	_, deletes, errs := Start(ctx, Options{
+	_, deletes, errs := mustStart(t, ctx, Options{
 		SQS:     sqsapi,
 		Receive: ReceiveOptions{RecieveMessageInput: input},
 		Delete:  DeleteOptions{Interval: time.Duration(100)},
@@ -203,7 +423,7 @@ func TestDeleteFailureInBatch(t *testing.T) {
 
 	sqsapi.
 		EXPECT().
-		ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		ReceiveMessageWithContext(gomock.Any(), &sqs.ReceiveMessageInput{
 			QueueUrl:            input.QueueUrl,
 			WaitTimeSeconds:     aws.Int64(20),
 			MaxNumberOfMessages: aws.Int64(1),
@@ -215,7 +435,7 @@ func TestDeleteFailureInBatch(t *testing.T) {
 
 	sqsapi.
 		EXPECT().
-		DeleteMessageBatchWithContext(ctx, &sqs.DeleteMessageBatchInput{
+		DeleteMessageBatchWithContext(gomock.Any(), &sqs.DeleteMessageBatchInput{
 			QueueUrl: aws.String("http://foo.bar"),
 			Entries: []*sqs.DeleteMessageBatchRequestEntry{
 				{
@@ -235,7 +455,7 @@ func TestDeleteFailureInBatch(t *testing.T) {
 			Successful: []*sqs.DeleteMessageBatchResultEntry{},
 		}, nil)
 
-	_, deletes, errs := Start(ctx, Options{
+	_, deletes, errs := mustStart(t, ctx, Options{
 		SQS:     sqsapi,
 		Receive: ReceiveOptions{RecieveMessageInput: input},
 		Delete:  DeleteOptions{Interval: time.Duration(100)},
@@ -246,3 +466,199 @@ func TestDeleteFailureInBatch(t *testing.T) {
 	assert.EqualError(t, err, "SQS batch delete error: message not found (NOT_FOUND)")
 	assert.EqualValues(t, "handle", err.(*BatchDeleteError).ReceiptHandle)
 }
+
+func TestReceiveWorkers(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl: aws.String("http://foo.bar"),
+	}
+
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), &sqs.ReceiveMessageInput{
+			QueueUrl:            input.QueueUrl,
+			WaitTimeSeconds:     aws.Int64(20),
+			MaxNumberOfMessages: aws.Int64(2),
+		}).
+		Return(&sqs.ReceiveMessageOutput{
+			Messages: []*sqs.Message{
+				{Body: aws.String("foo")},
+				{Body: aws.String("bar")},
+			},
+		}, nil)
+
+	blockReceives(sqsapi)
+
+	workers := make(chan Worker, 2)
+	foo, bar := make(chan *sqs.Message), make(chan *sqs.Message)
+	workers <- foo
+	workers <- bar
+
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: input, Workers: workers},
+	})
+
+	dispatch.Start(ctx)
+
+	sqsapi.
+		EXPECT().
+		DeleteMessageBatchWithContext(gomock.Any(), gomock.Any()).
+		Return(&sqs.DeleteMessageBatchOutput{}, nil)
+
+	first, second := <-foo, <-bar
+	assert.Equal(t, "foo", aws.StringValue(first.Body))
+	assert.Equal(t, "bar", aws.StringValue(second.Body))
+	assert.Equal(t, 0, dispatch.ReceiveCapacity())
+
+	dispatch.Deletes() <- first
+	dispatch.Deletes() <- second
+
+	assert.NoError(t, dispatch.Shutdown(ctx))
+}
+
+func TestErrorsDropped(t *testing.T) {
+	dispatch := newUnvalidated(Options{
+		Errors: ErrorOptions{BufferSize: 1},
+	})
+
+	dispatch.error(context.TODO(), errors.New("foo"))
+	dispatch.error(context.TODO(), errors.New("bar"))
+
+	assert.EqualError(t, <-dispatch.Errors(), "foo")
+	assert.Equal(t, int64(1), dispatch.DroppedErrors())
+}
+
+func TestErrorsHandler(t *testing.T) {
+	var handled error
+	dispatch := newUnvalidated(Options{
+		Errors: ErrorOptions{
+			Handler: func(err error) {
+				handled = err
+			},
+		},
+	})
+
+	dispatch.error(context.TODO(), errors.New("foo"))
+
+	assert.EqualError(t, handled, "foo")
+	assert.Len(t, dispatch.Errors(), 0)
+}
+
+func TestErrorsBlock(t *testing.T) {
+	dispatch := newUnvalidated(Options{
+		Errors: ErrorOptions{Block: true},
+	})
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	go cancel()
+
+	dispatch.error(ctx, errors.New("foo"))
+
+	assert.Equal(t, 0, cap(dispatch.Errors()))
+	assert.Equal(t, int64(0), dispatch.DroppedErrors())
+}
+
+func TestDeleteResults(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl: aws.String("http://foo.bar"),
+	}
+
+	foo := &sqs.Message{ReceiptHandle: aws.String("foo")}
+	bar := &sqs.Message{ReceiptHandle: aws.String("bar")}
+
+	blockReceives(sqsapi)
+
+	sqsapi.
+		EXPECT().
+		DeleteMessageBatchWithContext(gomock.Any(), gomock.Any()).
+		Return(&sqs.DeleteMessageBatchOutput{
+			Failed: []*sqs.BatchResultErrorEntry{
+				{
+					Id:      aws.String("1"),
+					Code:    aws.String("ReceiptHandleIsInvalid"),
+					Message: aws.String("invalid handle"),
+				},
+			},
+			Successful: []*sqs.DeleteMessageBatchResultEntry{
+				{Id: aws.String("0")},
+			},
+		}, nil)
+
+	var (
+		mutex   sync.Mutex
+		results []*DeleteResult
+	)
+
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: input},
+		Delete: DeleteOptions{
+			Interval: time.Hour,
+			ResultFunc: func(result *DeleteResult) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				results = append(results, result)
+			},
+		},
+	})
+
+	dispatch.Start(ctx)
+	dispatch.Deletes() <- foo
+	dispatch.Deletes() <- bar
+
+	assert.NoError(t, dispatch.Shutdown(ctx))
+
+	assert.Equal(t, []*DeleteResult{
+		{Message: foo},
+		{Message: bar, Err: &BatchDeleteError{
+			Code:          "ReceiptHandleIsInvalid",
+			Message:       "invalid handle",
+			ReceiptHandle: "bar",
+		}},
+	}, results)
+
+	err := <-dispatch.Errors()
+	assert.Equal(t, "bar", err.(*BatchDeleteError).ReceiptHandle)
+}
+
+func TestFake(t *testing.T) {
+	sqsapi := fake.New(fake.Options{})
+	queue, err := sqsapi.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String("queue")})
+	assert.NoError(t, err)
+
+	for i := 0; i < 25; i++ {
+		_, err := sqsapi.SendMessage(&sqs.SendMessageInput{QueueUrl: queue.QueueUrl, MessageBody: aws.String("hello")})
+		assert.NoError(t, err)
+	}
+
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: queue.QueueUrl}, BufferSize: 10},
+		Delete:  DeleteOptions{Interval: time.Millisecond},
+	})
+	dispatch.Start(context.Background())
+
+	for i := 0; i < 25; i++ {
+		dispatch.Deletes() <- <-dispatch.Receives()
+	}
+
+	assert.NoError(t, dispatch.Shutdown(context.Background()))
+
+	for message := range dispatch.Receives() {
+		t.Errorf("unexpected message: %v", message)
+	}
+
+	attributes, err := sqsapi.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       queue.QueueUrl,
+		AttributeNames: aws.StringSlice([]string{"All"}),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "0", aws.StringValue(attributes.Attributes["ApproximateNumberOfMessages"]))
+	assert.Equal(t, "0", aws.StringValue(attributes.Attributes["ApproximateNumberOfMessagesNotVisible"]))
+}
@@ -0,0 +1,149 @@
+package sqsch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Payload pointer classes written by the Amazon SQS Extended Client Library for Java
+// https://github.com/awslabs/amazon-sqs-java-extended-client-lib
+const (
+	PayloadS3PointerClass = "software.amazon.payloadoffloading.PayloadS3Pointer"
+	MessageS3PointerClass = "com.amazon.sqs.javamessaging.MessageS3Pointer"
+)
+
+// BlobStore stores message payloads that are too large to send through SQS.
+// Buckets and keys follow the naming of S3, which the extended client uses.
+type BlobStore interface {
+	Get(ctx context.Context, bucket, key string) ([]byte, error)
+	Put(ctx context.Context, bucket, key string, data []byte) error
+	Delete(ctx context.Context, bucket, key string) error
+}
+
+// ClaimCheckOptions configures resolution of message bodies that point to payloads in a
+// BlobStore (the claim-check pattern). Claim checks are disabled unless Store is set.
+type ClaimCheckOptions struct {
+	Store BlobStore
+	// RetainBlobs keeps payloads in the Store after their messages are deleted
+	RetainBlobs bool
+}
+
+// Enabled returns whether claim checks are enabled
+func (co *ClaimCheckOptions) Enabled() bool {
+	return co.Store != nil
+}
+
+// PayloadPointer identifies a payload stored in a BlobStore
+type PayloadPointer struct {
+	Bucket string `json:"s3BucketName"`
+	Key    string `json:"s3Key"`
+}
+
+// ParsePayloadPointer parses a message body written by the extended client, which is a JSON array
+// containing the pointer class and the pointer. It returns false if the body is not a pointer.
+func ParsePayloadPointer(body string) (*PayloadPointer, bool) {
+	var fields []json.RawMessage
+	if err := json.Unmarshal([]byte(body), &fields); err != nil || len(fields) != 2 {
+		return nil, false
+	}
+
+	var class string
+	if err := json.Unmarshal(fields[0], &class); err != nil {
+		return nil, false
+	}
+
+	if class != PayloadS3PointerClass && class != MessageS3PointerClass {
+		return nil, false
+	}
+
+	pointer := &PayloadPointer{}
+	if err := json.Unmarshal(fields[1], pointer); err != nil || pointer.Bucket == "" || pointer.Key == "" {
+		return nil, false
+	}
+
+	return pointer, true
+}
+
+// ClaimCheckError represents a failure to get or delete the payload of a message
+type ClaimCheckError struct {
+	Message *sqs.Message
+	Pointer *PayloadPointer
+	Err     error
+}
+
+func (err *ClaimCheckError) Error() string {
+	return fmt.Sprintf("claim check error: s3://%s/%s: %s", err.Pointer.Bucket, err.Pointer.Key, err.Err)
+}
+
+// Unwrap returns the error returned by the BlobStore
+func (err *ClaimCheckError) Unwrap() error {
+	return err.Err
+}
+
+// resolve replaces the body of a message that points to a payload with the payload itself
+// and remembers the pointer so that the payload can be deleted along with the message
+func (d *Dispatch) resolve(ctx context.Context, message *sqs.Message) error {
+	if !d.Options.ClaimCheck.Enabled() {
+		return nil
+	}
+
+	pointer, ok := ParsePayloadPointer(aws.StringValue(message.Body))
+	if !ok {
+		return nil
+	}
+
+	payload, err := d.Options.ClaimCheck.Store.Get(ctx, pointer.Bucket, pointer.Key)
+	if err != nil {
+		return &ClaimCheckError{Message: message, Pointer: pointer, Err: err}
+	}
+
+	message.Body = aws.String(string(payload))
+	d.claims.add(message, pointer)
+
+	return nil
+}
+
+// deleteBlob deletes the payload of a deleted message unless ClaimCheck.RetainBlobs is set
+func (d *Dispatch) deleteBlob(ctx context.Context, message *sqs.Message) {
+	pointer := d.claims.remove(message)
+	if pointer == nil || d.Options.ClaimCheck.RetainBlobs {
+		return
+	}
+
+	if err := d.Options.ClaimCheck.Store.Delete(ctx, pointer.Bucket, pointer.Key); err != nil {
+		d.error(ctx, &ClaimCheckError{Message: message, Pointer: pointer, Err: err})
+	}
+}
+
+// claims tracks the payload pointers of received messages by receipt handle
+type claims struct {
+	mutex    sync.Mutex
+	pointers map[string]*PayloadPointer
+}
+
+func newClaims() *claims {
+	return &claims{pointers: make(map[string]*PayloadPointer)}
+}
+
+func (c *claims) add(message *sqs.Message, pointer *PayloadPointer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.pointers[aws.StringValue(message.ReceiptHandle)] = pointer
+}
+
+func (c *claims) remove(message *sqs.Message) *PayloadPointer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	handle := aws.StringValue(message.ReceiptHandle)
+	pointer := c.pointers[handle]
+	delete(c.pointers, handle)
+
+	return pointer
+}
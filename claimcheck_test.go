@@ -0,0 +1,167 @@
+package sqsch
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bendrucker/sqs-receive-channel/mock"
+	"github.com/bendrucker/sqs-receive-channel/pkg/blob"
+)
+
+const pointer = `["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket","s3Key":"key"}]`
+
+func TestParsePayloadPointer(t *testing.T) {
+	p, ok := ParsePayloadPointer(pointer)
+	assert.True(t, ok)
+	assert.Equal(t, &PayloadPointer{Bucket: "bucket", Key: "key"}, p)
+
+	p, ok = ParsePayloadPointer(`["com.amazon.sqs.javamessaging.MessageS3Pointer",{"s3BucketName":"bucket","s3Key":"key"}]`)
+	assert.True(t, ok)
+	assert.Equal(t, &PayloadPointer{Bucket: "bucket", Key: "key"}, p)
+
+	for _, body := range []string{
+		`hello`,
+		`["foo", "bar"]`,
+		`["com.example.Pointer",{"s3BucketName":"bucket","s3Key":"key"}]`,
+		`["software.amazon.payloadoffloading.PayloadS3Pointer",{}]`,
+	} {
+		_, ok := ParsePayloadPointer(body)
+		assert.False(t, ok, body)
+	}
+}
+
+func expectPointer(sqsapi *mock.MockSQSAPI) {
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), gomock.Any()).
+		Return(&sqs.ReceiveMessageOutput{
+			Messages: []*sqs.Message{{
+				Body:          aws.String(pointer),
+				ReceiptHandle: aws.String("handle"),
+			}},
+		}, nil)
+
+	blockReceives(sqsapi)
+}
+
+func TestClaimCheck(t *testing.T) {
+	for _, retain := range []bool{false, true} {
+		ctx, sqsapi, finish := setup(t)
+		store := blob.Dir(t.TempDir())
+		assert.NoError(t, store.Put(ctx, "bucket", "key", []byte("payload")))
+
+		expectPointer(sqsapi)
+
+		sqsapi.
+			EXPECT().
+			DeleteMessageBatchWithContext(gomock.Any(), gomock.Any()).
+			Return(&sqs.DeleteMessageBatchOutput{}, nil)
+
+		dispatch := mustNew(t, Options{
+			SQS:        sqsapi,
+			Receive:    ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: aws.String("http://foo.bar")}},
+			Delete:     DeleteOptions{Interval: time.Millisecond},
+			ClaimCheck: ClaimCheckOptions{Store: store, RetainBlobs: retain},
+		})
+		dispatch.Start(ctx)
+
+		message := <-dispatch.Receives()
+		assert.Equal(t, "payload", aws.StringValue(message.Body))
+		assert.NoError(t, dispatch.Ack(ctx, message))
+
+		_, err := store.Get(ctx, "bucket", "key")
+		if retain {
+			assert.NoError(t, err)
+		} else {
+			assert.True(t, errors.Is(err, fs.ErrNotExist))
+		}
+
+		finish()
+	}
+}
+
+func TestClaimCheckMissing(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	expectPointer(sqsapi)
+
+	sqsapi.
+		EXPECT().
+		ChangeMessageVisibilityBatchWithContext(gomock.Any(), &sqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String("http://foo.bar"),
+			Entries: []*sqs.ChangeMessageVisibilityBatchRequestEntry{{
+				Id:                aws.String("0"),
+				ReceiptHandle:     aws.String("handle"),
+				VisibilityTimeout: aws.Int64(0),
+			}},
+		}).
+		Return(&sqs.ChangeMessageVisibilityBatchOutput{}, nil)
+
+	dispatch := mustNew(t, Options{
+		SQS:        sqsapi,
+		Receive:    ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: aws.String("http://foo.bar")}},
+		Delete:     DeleteOptions{Interval: time.Millisecond},
+		ClaimCheck: ClaimCheckOptions{Store: blob.Dir(t.TempDir())},
+	})
+	dispatch.Start(ctx)
+
+	err := <-dispatch.Errors()
+	assert.IsType(t, &ClaimCheckError{}, err)
+	assert.Equal(t, &PayloadPointer{Bucket: "bucket", Key: "key"}, err.(*ClaimCheckError).Pointer)
+	assert.NoError(t, dispatch.Shutdown(context.TODO()))
+}
+
+// barrierStore returns payloads from Get once Get has been called for every pending key
+type barrierStore struct {
+	BlobStore
+	pending sync.WaitGroup
+}
+
+func (s *barrierStore) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	s.pending.Done()
+
+	done := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return []byte(key), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestClaimCheckConcurrent(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	store := &barrierStore{}
+	store.pending.Add(2)
+
+	dispatch := newUnvalidated(Options{ClaimCheck: ClaimCheckOptions{Store: store}})
+
+	messages := []*sqs.Message{
+		{Body: aws.String(`["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket","s3Key":"a"}]`), ReceiptHandle: aws.String("a")},
+		{Body: aws.String(`["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket","s3Key":"b"}]`), ReceiptHandle: aws.String("b")},
+	}
+
+	for i, result := range dispatch.prepare(ctx, messages) {
+		r := result.(*received)
+		assert.NoError(t, r.err)
+		assert.Equal(t, messages[i], r.message)
+		assert.Equal(t, aws.StringValue(r.message.ReceiptHandle), aws.StringValue(r.message.Body))
+	}
+}
@@ -0,0 +1,69 @@
+// Command sqsch-local serves an in-memory SQS API over HTTP for local development and tests.
+// Point an SDK client's endpoint at the server. A POST request to /_sqsch/reset deletes every queue.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/bendrucker/sqs-receive-channel/fake"
+)
+
+// queues is a flag that can be repeated to create queues at startup
+type queues []string
+
+func (q *queues) String() string {
+	return strings.Join(*q, ",")
+}
+
+func (q *queues) Set(value string) error {
+	*q = append(*q, value)
+	return nil
+}
+
+func main() {
+	var (
+		addr     = flag.String("addr", "localhost:9324", "address to listen on")
+		endpoint = flag.String("endpoint", "", "base of queue URLs (default: http://<addr>)")
+		region   = flag.String("region", "us-east-1", "region used in queue ARNs")
+		account  = flag.String("account", "000000000000", "account id used in queue URLs and ARNs")
+		create   queues
+	)
+
+	flag.Var(&create, "queue", "name of a queue to create at startup (repeatable, names ending in .fifo create FIFO queues)")
+	flag.Parse()
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *endpoint == "" {
+		*endpoint = fmt.Sprintf("http://%s", listener.Addr())
+	}
+
+	service := fake.New(fake.Options{Endpoint: *endpoint, Region: *region, AccountID: *account})
+
+	for _, name := range create {
+		input := &sqs.CreateQueueInput{QueueName: aws.String(name)}
+		if strings.HasSuffix(name, ".fifo") {
+			input.Attributes = map[string]*string{sqs.QueueAttributeNameFifoQueue: aws.String("true")}
+		}
+
+		output, err := service.CreateQueue(input)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("created queue %s", aws.StringValue(output.QueueUrl))
+	}
+
+	log.Printf("listening on %s", *endpoint)
+	log.Fatal(http.Serve(listener, service))
+}
@@ -0,0 +1,211 @@
+package sqsch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Decoder decodes a message into a value of type T
+type Decoder[T any] interface {
+	Decode(message *sqs.Message) (T, error)
+}
+
+// DecoderFunc is an adapter that allows an ordinary function to be used as a Decoder
+type DecoderFunc[T any] func(message *sqs.Message) (T, error)
+
+// Decode calls f(message)
+func (f DecoderFunc[T]) Decode(message *sqs.Message) (T, error) {
+	return f(message)
+}
+
+// JSONDecoder returns a Decoder that unmarshals the message body as JSON
+func JSONDecoder[T any]() Decoder[T] {
+	return DecoderFunc[T](func(message *sqs.Message) (T, error) {
+		var value T
+		err := json.Unmarshal([]byte(aws.StringValue(message.Body)), &value)
+		return value, err
+	})
+}
+
+// TypedMessage is a decoded value along with the message it was decoded from.
+// The message should be sent to the delete or release channel once processed.
+type TypedMessage[T any] struct {
+	Value   T
+	Message *sqs.Message
+}
+
+// DecodeFailurePolicy determines what happens to a message that cannot be decoded
+type DecodeFailurePolicy int
+
+const (
+	// DecodeFailureRelease returns the message to the queue so it is retried (and
+	// eventually moved to the queue's dead-letter queue by its redrive policy)
+	DecodeFailureRelease DecodeFailurePolicy = iota
+	// DecodeFailureDelete deletes the message
+	DecodeFailureDelete
+	// DecodeFailureDeadLetter sends the message to Decode.DeadLetterQueueURL and deletes it
+	DecodeFailureDeadLetter
+)
+
+// DecodeOptions configures handling of messages that cannot be decoded
+type DecodeOptions struct {
+	Failure            DecodeFailurePolicy
+	DeadLetterQueueURL *string
+}
+
+// DecodeError represents a message that could not be decoded
+type DecodeError struct {
+	Message *sqs.Message
+	Err     error
+}
+
+func (err *DecodeError) Error() string {
+	return fmt.Sprintf("decode error: %s", err.Err)
+}
+
+// Unwrap returns the error returned by the Decoder
+func (err *DecodeError) Unwrap() error {
+	return err.Err
+}
+
+// TypedDispatch is a started Dispatch that decodes each received message. Read decoded
+// messages from Messages instead of Receives, and send them to Deletes or Releases once
+// they are processed.
+type TypedDispatch[T any] struct {
+	*Dispatch
+	messages <-chan *TypedMessage[T]
+}
+
+// Messages returns the channel that decoded messages are sent to. It is closed once
+// receiving stops.
+func (d *TypedDispatch[T]) Messages() <-chan *TypedMessage[T] {
+	return d.messages
+}
+
+// StartTyped starts a Dispatch like Start, but decodes each received message with decoder
+// (default: JSONDecoder) and delivers the decoded values. Messages that fail to decode are
+// reported as a *DecodeError and handled according to Decode.Failure.
+func StartTyped[T any](ctx context.Context, options Options, decoder Decoder[T]) (*TypedDispatch[T], error) {
+	dispatch, err := New(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	dispatch.Start(ctx)
+
+	return &TypedDispatch[T]{Dispatch: dispatch, messages: DecodeMessages(ctx, dispatch, decoder)}, nil
+}
+
+// DecodeMessages reads messages from the receive channel of a started Dispatch and decodes
+// them with decoder (default: JSONDecoder). The returned channel is closed once receiving
+// stops, and messages that were decoded but not yet delivered are released. Messages that
+// fail to decode are reported as a *DecodeError and handled according to Decode.Failure.
+func DecodeMessages[T any](ctx context.Context, d *Dispatch, decoder Decoder[T]) <-chan *TypedMessage[T] {
+	if decoder == nil {
+		decoder = JSONDecoder[T]()
+	}
+
+	output := make(chan *TypedMessage[T])
+	d.consumers.Add(1)
+
+	go func() {
+		defer d.consumers.Done()
+		defer close(output)
+
+		for message := range d.receives {
+			value, err := decoder.Decode(message)
+
+			if err != nil {
+				d.decodeFailure(ctx, &DecodeError{Message: message, Err: err})
+				continue
+			}
+
+			select {
+			case output <- &TypedMessage[T]{Value: value, Message: message}:
+			case <-d.receiveDone:
+				d.requeue(message)
+			}
+		}
+	}()
+
+	return output
+}
+
+func (d *Dispatch) decodeFailure(ctx context.Context, failure *DecodeError) {
+	d.error(ctx, failure)
+	message := failure.Message
+
+	switch d.Options.Decode.Failure {
+	case DecodeFailureDelete:
+		d.discard(message)
+	case DecodeFailureDeadLetter:
+		if err := d.deadLetter(ctx, message); err != nil {
+			d.error(ctx, err)
+			d.requeue(message)
+			return
+		}
+
+		d.discard(message)
+	default:
+		d.requeue(message)
+	}
+}
+
+// discard deletes a message that failed to decode, or forgets it if processing has been aborted
+func (d *Dispatch) discard(message *sqs.Message) {
+	select {
+	case d.deletes <- message:
+	case <-d.processDone:
+		d.forget(message)
+	}
+}
+
+// DeadLetterError represents a failure to send a message to Decode.DeadLetterQueueURL
+type DeadLetterError struct {
+	Message *sqs.Message
+	Err     error
+}
+
+func (err *DeadLetterError) Error() string {
+	return fmt.Sprintf("dead-letter error: %s", err.Err)
+}
+
+func (d *Dispatch) deadLetter(ctx context.Context, message *sqs.Message) error {
+	if d.Options.Decode.DeadLetterQueueURL == nil {
+		return &DeadLetterError{Message: message, Err: errors.New("dead-letter queue URL is not set")}
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:          d.Options.Decode.DeadLetterQueueURL,
+		MessageBody:       message.Body,
+		MessageAttributes: message.MessageAttributes,
+	}
+
+	// FIFO queues require a message group, which is kept if the message came from a FIFO
+	// queue, and deduplicate by MessageId so that redelivered messages are sent once
+	if strings.HasSuffix(aws.StringValue(input.QueueUrl), ".fifo") {
+		input.MessageGroupId = message.Attributes[MessageGroupId]
+		if input.MessageGroupId == nil {
+			input.MessageGroupId = message.MessageId
+		}
+
+		input.MessageDeduplicationId = message.MessageId
+	}
+
+	start := time.Now()
+	_, err := d.Options.SQS.SendMessageWithContext(ctx, input)
+	d.observe("SendMessage", start, err)
+
+	if err != nil {
+		return &DeadLetterError{Message: message, Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package sqsch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+type greeting struct {
+	Hello string `json:"hello"`
+}
+
+func TestStartTyped(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl: aws.String("http://foo.bar"),
+	}
+
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), gomock.Any()).
+		Return(&sqs.ReceiveMessageOutput{
+			Messages: []*sqs.Message{{
+				Body:          aws.String(`{"hello": "world"}`),
+				ReceiptHandle: aws.String("handle"),
+			}},
+		}, nil).
+		AnyTimes()
+
+	expectReleases(sqsapi)
+
+	dispatch, err := StartTyped[greeting](ctx, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: input},
+	}, nil)
+	assert.NoError(t, err)
+
+	message := <-dispatch.Messages()
+	assert.Equal(t, greeting{Hello: "world"}, message.Value)
+	assert.Equal(t, "handle", aws.StringValue(message.Message.ReceiptHandle))
+
+	dispatch.Releases() <- &Release{Message: message.Message}
+	assert.NoError(t, dispatch.Shutdown(ctx))
+}
+
+func TestStartTypedDecoder(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl: aws.String("http://foo.bar"),
+	}
+
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), gomock.Any()).
+		Return(&sqs.ReceiveMessageOutput{
+			Messages: []*sqs.Message{{Body: aws.String("hello")}},
+		}, nil).
+		AnyTimes()
+
+	expectReleases(sqsapi)
+
+	dispatch, err := StartTyped[int](ctx, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: input},
+		Delete:  DeleteOptions{Interval: time.Hour},
+	}, DecoderFunc[int](func(message *sqs.Message) (int, error) {
+		return len(aws.StringValue(message.Body)), nil
+	}))
+	assert.NoError(t, err)
+
+	sqsapi.
+		EXPECT().
+		DeleteMessageBatchWithContext(gomock.Any(), gomock.Any()).
+		Return(&sqs.DeleteMessageBatchOutput{}, nil)
+
+	message := <-dispatch.Messages()
+	assert.Equal(t, 5, message.Value)
+
+	dispatch.Deletes() <- message.Message
+	assert.NoError(t, dispatch.Shutdown(ctx))
+}
+
+func TestStartTypedInvalid(t *testing.T) {
+	dispatch, err := StartTyped[greeting](context.Background(), Options{}, nil)
+	assert.Nil(t, dispatch)
+	assert.IsType(t, &ValidationError{}, err)
+}
+
+func TestDecodeFailure(t *testing.T) {
+	cases := []struct {
+		policy DecodeFailurePolicy
+		expect func(*testing.T, *sqs.Message, *Dispatch)
+	}{
+		{
+			DecodeFailureRelease,
+			func(t *testing.T, message *sqs.Message, d *Dispatch) {
+				assert.Equal(t, &Release{Message: message}, <-d.releases)
+			},
+		},
+		{
+			DecodeFailureDelete,
+			func(t *testing.T, message *sqs.Message, d *Dispatch) {
+				assert.Equal(t, message, <-d.deletes)
+			},
+		},
+	}
+
+	for _, c := range cases {
+		message := &sqs.Message{Body: aws.String("not json")}
+		dispatch := newUnvalidated(Options{Decode: DecodeOptions{Failure: c.policy}})
+		dispatch.receives <- message
+		close(dispatch.receives)
+
+		received := DecodeMessages[greeting](context.TODO(), dispatch, nil)
+
+		_, ok := <-received
+		assert.False(t, ok)
+
+		err := <-dispatch.Errors()
+		assert.IsType(t, &DecodeError{}, err)
+		assert.Equal(t, message, err.(*DecodeError).Message)
+
+		c.expect(t, message, dispatch)
+	}
+}
+
+func TestDecodeFailureDeadLetter(t *testing.T) {
+	_, sqsapi, finish := setup(t)
+	defer finish()
+
+	message := &sqs.Message{
+		Body:          aws.String("not json"),
+		ReceiptHandle: aws.String("handle"),
+	}
+
+	sqsapi.
+		EXPECT().
+		SendMessageWithContext(gomock.Any(), &sqs.SendMessageInput{
+			QueueUrl:    aws.String("http://foo.bar/dlq"),
+			MessageBody: aws.String("not json"),
+		}).
+		Return(&sqs.SendMessageOutput{}, nil)
+
+	dispatch := newUnvalidated(Options{
+		SQS: sqsapi,
+		Decode: DecodeOptions{
+			Failure:            DecodeFailureDeadLetter,
+			DeadLetterQueueURL: aws.String("http://foo.bar/dlq"),
+		},
+		Delete: DeleteOptions{Interval: time.Hour},
+	})
+
+	dispatch.receives <- message
+	close(dispatch.receives)
+
+	for range DecodeMessages[greeting](context.TODO(), dispatch, nil) {
+	}
+
+	assert.Equal(t, message, <-dispatch.deletes)
+}
+
+func TestDecodeFailureDeadLetterFIFO(t *testing.T) {
+	_, sqsapi, finish := setup(t)
+	defer finish()
+
+	message := &sqs.Message{
+		MessageId:     aws.String("id"),
+		Body:          aws.String("not json"),
+		ReceiptHandle: aws.String("handle"),
+		Attributes:    aws.StringMap(map[string]string{MessageGroupId: "group"}),
+	}
+
+	sqsapi.
+		EXPECT().
+		SendMessageWithContext(gomock.Any(), &sqs.SendMessageInput{
+			QueueUrl:               aws.String("http://foo.bar/dlq.fifo"),
+			MessageBody:            aws.String("not json"),
+			MessageGroupId:         aws.String("group"),
+			MessageDeduplicationId: aws.String("id"),
+		}).
+		Return(&sqs.SendMessageOutput{}, nil)
+
+	dispatch := newUnvalidated(Options{
+		SQS: sqsapi,
+		Decode: DecodeOptions{
+			Failure:            DecodeFailureDeadLetter,
+			DeadLetterQueueURL: aws.String("http://foo.bar/dlq.fifo"),
+		},
+	})
+
+	assert.NoError(t, dispatch.deadLetter(context.TODO(), message))
+}
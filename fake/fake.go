@@ -0,0 +1,291 @@
+// Package fake provides a stateful in-memory implementation of the SQS API for tests.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// Error codes returned by SQS that are not defined by the SDK
+const (
+	ErrCodeInvalidParameterValue = "InvalidParameterValue"
+	ErrCodeMissingParameter      = "MissingParameter"
+)
+
+// Options configures a fake SQS service
+type Options struct {
+	// Endpoint is the base of queue URLs (default: https://sqs.us-east-1.amazonaws.com)
+	Endpoint string
+	// Region is used in queue ARNs (default: us-east-1)
+	Region string
+	// AccountID is used in queue URLs and ARNs (default: 000000000000)
+	AccountID string
+	// Now returns the current time, which determines when messages become visible (default: time.Now).
+	// Long polls always wait in real time.
+	Now func() time.Time
+}
+
+// Defaults sets default values
+func (o *Options) Defaults() {
+	if o.Endpoint == "" {
+		o.Endpoint = "https://sqs.us-east-1.amazonaws.com"
+	}
+
+	if o.Region == "" {
+		o.Region = "us-east-1"
+	}
+
+	if o.AccountID == "" {
+		o.AccountID = "000000000000"
+	}
+
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+}
+
+// SQS is an in-memory SQS service. It models visibility timeouts, long polling, receive
+// counts, batch requests with partial failures, redrive to dead-letter queues, and FIFO
+// queues. Methods that are not implemented panic.
+type SQS struct {
+	// SQSAPI is embedded so that SQS implements sqsiface.SQSAPI.
+	// It is nil, so calling an unimplemented method panics.
+	sqsiface.SQSAPI
+
+	Options Options
+
+	mutex   sync.Mutex
+	queues  map[string]*queue
+	handles map[string]*message
+	// secret signs receipt handles, so that handles of deleted messages can be recognized
+	// without keeping them
+	secret  []byte
+	ids     int64
+	changed chan struct{}
+}
+
+// New creates an SQS service with no queues
+func New(options Options) *SQS {
+	options.Defaults()
+
+	return &SQS{
+		Options: options,
+		queues:  make(map[string]*queue),
+		handles: make(map[string]*message),
+		secret:  random(32),
+		changed: make(chan struct{}),
+	}
+}
+
+var _ sqsiface.SQSAPI = (*SQS)(nil)
+
+// notify wakes long polls after messages may have become available. It must be called with the mutex held.
+func (s *SQS) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// queue returns the queue identified by a queue URL. It must be called with the mutex held.
+func (s *SQS) queue(queueURL *string) (*queue, error) {
+	if queueURL == nil {
+		return nil, awserr.New(ErrCodeMissingParameter, "The request must contain the parameter QueueUrl.", nil)
+	}
+
+	u, err := url.Parse(aws.StringValue(queueURL))
+	if err != nil {
+		return nil, awserr.New(ErrCodeInvalidParameterValue, "Invalid QueueUrl.", err)
+	}
+
+	if q, ok := s.queues[path.Base(u.Path)]; ok {
+		return q, nil
+	}
+
+	return nil, awserr.New(sqs.ErrCodeQueueDoesNotExist, "The specified queue does not exist for this wsdl version.", nil)
+}
+
+var queueName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,80}$`)
+
+// CreateQueue creates a queue, or returns the URL of an existing queue with the same attributes
+func (s *SQS) CreateQueue(input *sqs.CreateQueueInput) (*sqs.CreateQueueOutput, error) {
+	return s.CreateQueueWithContext(context.Background(), input)
+}
+
+// CreateQueueWithContext creates a queue, or returns the URL of an existing queue with the same attributes
+func (s *SQS) CreateQueueWithContext(ctx aws.Context, input *sqs.CreateQueueInput, opts ...request.Option) (*sqs.CreateQueueOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	name := aws.StringValue(input.QueueName)
+	fifo := aws.StringValue(input.Attributes[sqs.QueueAttributeNameFifoQueue]) == "true"
+
+	if !queueName.MatchString(strings.TrimSuffix(name, ".fifo")) || fifo != strings.HasSuffix(name, ".fifo") {
+		return nil, awserr.New(ErrCodeInvalidParameterValue, fmt.Sprintf("Invalid queue name: %s", name), nil)
+	}
+
+	q := newQueue(s, name, s.Options.Now())
+	if err := q.setAttributes(input.Attributes, true); err != nil {
+		return nil, err
+	}
+
+	if existing, ok := s.queues[name]; ok {
+		for key := range input.Attributes {
+			if value := q.attributes[key]; existing.attributes[key] != value {
+				return nil, awserr.New(sqs.ErrCodeQueueNameExists, fmt.Sprintf("A queue already exists with the same name and a different value for attribute %s", key), nil)
+			}
+		}
+
+		return &sqs.CreateQueueOutput{QueueUrl: aws.String(existing.url)}, nil
+	}
+
+	s.queues[name] = q
+
+	return &sqs.CreateQueueOutput{QueueUrl: aws.String(q.url)}, nil
+}
+
+// GetQueueUrl returns the URL of a queue
+func (s *SQS) GetQueueUrl(input *sqs.GetQueueUrlInput) (*sqs.GetQueueUrlOutput, error) {
+	return s.GetQueueUrlWithContext(context.Background(), input)
+}
+
+// GetQueueUrlWithContext returns the URL of a queue
+func (s *SQS) GetQueueUrlWithContext(ctx aws.Context, input *sqs.GetQueueUrlInput, opts ...request.Option) (*sqs.GetQueueUrlOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	q, ok := s.queues[aws.StringValue(input.QueueName)]
+	if !ok {
+		return nil, awserr.New(sqs.ErrCodeQueueDoesNotExist, "The specified queue does not exist for this wsdl version.", nil)
+	}
+
+	return &sqs.GetQueueUrlOutput{QueueUrl: aws.String(q.url)}, nil
+}
+
+// DeleteQueue deletes a queue and its messages
+func (s *SQS) DeleteQueue(input *sqs.DeleteQueueInput) (*sqs.DeleteQueueOutput, error) {
+	return s.DeleteQueueWithContext(context.Background(), input)
+}
+
+// DeleteQueueWithContext deletes a queue and its messages
+func (s *SQS) DeleteQueueWithContext(ctx aws.Context, input *sqs.DeleteQueueInput, opts ...request.Option) (*sqs.DeleteQueueOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(s.queues, q.name)
+	s.forget(q.messages...)
+	s.notify()
+
+	return &sqs.DeleteQueueOutput{}, nil
+}
+
+// ListQueues returns the URLs of queues, optionally filtered by a name prefix
+func (s *SQS) ListQueues(input *sqs.ListQueuesInput) (*sqs.ListQueuesOutput, error) {
+	return s.ListQueuesWithContext(context.Background(), input)
+}
+
+// ListQueuesWithContext returns the URLs of queues, optionally filtered by a name prefix
+func (s *SQS) ListQueuesWithContext(ctx aws.Context, input *sqs.ListQueuesInput, opts ...request.Option) (*sqs.ListQueuesOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var names []string
+	for name := range s.queues {
+		if strings.HasPrefix(name, aws.StringValue(input.QueueNamePrefix)) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	output := &sqs.ListQueuesOutput{}
+	for _, name := range names {
+		output.QueueUrls = append(output.QueueUrls, aws.String(s.queues[name].url))
+	}
+
+	return output, nil
+}
+
+// GetQueueAttributes returns the attributes of a queue
+func (s *SQS) GetQueueAttributes(input *sqs.GetQueueAttributesInput) (*sqs.GetQueueAttributesOutput, error) {
+	return s.GetQueueAttributesWithContext(context.Background(), input)
+}
+
+// GetQueueAttributesWithContext returns the attributes of a queue
+func (s *SQS) GetQueueAttributesWithContext(ctx aws.Context, input *sqs.GetQueueAttributesInput, opts ...request.Option) (*sqs.GetQueueAttributesOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes, err := q.getAttributes(aws.StringValueSlice(input.AttributeNames), s.Options.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqs.GetQueueAttributesOutput{Attributes: aws.StringMap(attributes)}, nil
+}
+
+// SetQueueAttributes sets the attributes of a queue
+func (s *SQS) SetQueueAttributes(input *sqs.SetQueueAttributesInput) (*sqs.SetQueueAttributesOutput, error) {
+	return s.SetQueueAttributesWithContext(context.Background(), input)
+}
+
+// SetQueueAttributesWithContext sets the attributes of a queue
+func (s *SQS) SetQueueAttributesWithContext(ctx aws.Context, input *sqs.SetQueueAttributesInput, opts ...request.Option) (*sqs.SetQueueAttributesOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := q.setAttributes(input.Attributes, false); err != nil {
+		return nil, err
+	}
+
+	q.modified = s.Options.Now()
+
+	return &sqs.SetQueueAttributesOutput{}, nil
+}
+
+// PurgeQueue deletes every message in a queue
+func (s *SQS) PurgeQueue(input *sqs.PurgeQueueInput) (*sqs.PurgeQueueOutput, error) {
+	return s.PurgeQueueWithContext(context.Background(), input)
+}
+
+// PurgeQueueWithContext deletes every message in a queue
+func (s *SQS) PurgeQueueWithContext(ctx aws.Context, input *sqs.PurgeQueueInput, opts ...request.Option) (*sqs.PurgeQueueOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	s.forget(q.messages...)
+	q.messages = nil
+
+	return &sqs.PurgeQueueOutput{}, nil
+}
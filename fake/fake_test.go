@@ -0,0 +1,129 @@
+package fake
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+// clock is a manually advanced time source
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func setup(t *testing.T) (*SQS, *clock) {
+	c := &clock{now: time.Unix(1500000000, 0)}
+	return New(Options{Now: c.Now}), c
+}
+
+func createQueue(t *testing.T, s *SQS, name string, attributes map[string]string) *string {
+	output, err := s.CreateQueue(&sqs.CreateQueueInput{
+		QueueName:  aws.String(name),
+		Attributes: aws.StringMap(attributes),
+	})
+
+	assert.NoError(t, err)
+	return output.QueueUrl
+}
+
+func code(err error) string {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code()
+	}
+
+	return ""
+}
+
+func TestCreateQueue(t *testing.T) {
+	s, _ := setup(t)
+
+	url := createQueue(t, s, "queue", map[string]string{"VisibilityTimeout": "60"})
+	assert.Equal(t, "https://sqs.us-east-1.amazonaws.com/000000000000/queue", aws.StringValue(url))
+	assert.Equal(t, url, createQueue(t, s, "queue", map[string]string{"VisibilityTimeout": "60"}))
+
+	_, err := s.CreateQueue(&sqs.CreateQueueInput{
+		QueueName:  aws.String("queue"),
+		Attributes: aws.StringMap(map[string]string{"VisibilityTimeout": "30"}),
+	})
+	assert.Equal(t, sqs.ErrCodeQueueNameExists, code(err))
+
+	_, err = s.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String("queue.fifo")})
+	assert.Equal(t, ErrCodeInvalidParameterValue, code(err))
+
+	_, err = s.CreateQueue(&sqs.CreateQueueInput{
+		QueueName:  aws.String("queue"),
+		Attributes: aws.StringMap(map[string]string{"VisibilityTimeout": "forever"}),
+	})
+	assert.Equal(t, ErrCodeInvalidParameterValue, code(err))
+
+	output, err := s.GetQueueUrl(&sqs.GetQueueUrlInput{QueueName: aws.String("queue")})
+	assert.NoError(t, err)
+	assert.Equal(t, url, output.QueueUrl)
+
+	list, err := s.ListQueues(&sqs.ListQueuesInput{})
+	assert.NoError(t, err)
+	assert.Equal(t, []*string{url}, list.QueueUrls)
+
+	_, err = s.DeleteQueue(&sqs.DeleteQueueInput{QueueUrl: url})
+	assert.NoError(t, err)
+
+	_, err = s.GetQueueUrl(&sqs.GetQueueUrlInput{QueueName: aws.String("queue")})
+	assert.Equal(t, sqs.ErrCodeQueueDoesNotExist, code(err))
+}
+
+func TestQueueAttributes(t *testing.T) {
+	s, c := setup(t)
+	url := createQueue(t, s, "queue", nil)
+
+	_, err := s.SetQueueAttributes(&sqs.SetQueueAttributesInput{
+		QueueUrl:   url,
+		Attributes: aws.StringMap(map[string]string{"DelaySeconds": "10"}),
+	})
+	assert.NoError(t, err)
+
+	_, err = s.SendMessage(&sqs.SendMessageInput{QueueUrl: url, MessageBody: aws.String("delayed")})
+	assert.NoError(t, err)
+
+	attributes := func() map[string]string {
+		output, err := s.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+			QueueUrl:       url,
+			AttributeNames: aws.StringSlice([]string{"All"}),
+		})
+
+		assert.NoError(t, err)
+		return aws.StringValueMap(output.Attributes)
+	}
+
+	assert.Equal(t, "10", attributes()["DelaySeconds"])
+	assert.Equal(t, "arn:aws:sqs:us-east-1:000000000000:queue", attributes()["QueueArn"])
+	assert.Equal(t, "1", attributes()["ApproximateNumberOfMessagesDelayed"])
+
+	c.Advance(10 * time.Second)
+	assert.Equal(t, "1", attributes()["ApproximateNumberOfMessages"])
+
+	_, err = s.ReceiveMessage(&sqs.ReceiveMessageInput{QueueUrl: url})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", attributes()["ApproximateNumberOfMessagesNotVisible"])
+
+	_, err = s.PurgeQueue(&sqs.PurgeQueueInput{QueueUrl: url})
+	assert.NoError(t, err)
+	assert.Equal(t, "0", attributes()["ApproximateNumberOfMessagesNotVisible"])
+
+	_, err = s.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       url,
+		AttributeNames: aws.StringSlice([]string{"Color"}),
+	})
+	assert.Equal(t, sqs.ErrCodeInvalidAttributeName, code(err))
+}
@@ -0,0 +1,771 @@
+package fake
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// ErrCodeRequestCanceled is the code of the error returned when the context of a request is canceled
+const ErrCodeRequestCanceled = "RequestCanceled"
+
+// Message system attributes
+const (
+	AttributeSenderId                         = "SenderId"
+	AttributeSentTimestamp                    = "SentTimestamp"
+	AttributeApproximateReceiveCount          = "ApproximateReceiveCount"
+	AttributeApproximateFirstReceiveTimestamp = "ApproximateFirstReceiveTimestamp"
+	AttributeMessageGroupId                   = "MessageGroupId"
+	AttributeMessageDeduplicationId           = "MessageDeduplicationId"
+	AttributeSequenceNumber                   = "SequenceNumber"
+)
+
+// SenderId is the SenderId attribute of every message
+const SenderId = "AIDAFAKESENDER"
+
+// pollInterval is how often long polls check for messages whose visibility timeout expired
+const pollInterval = 50 * time.Millisecond
+
+// message is a message stored in a queue
+type message struct {
+	id              string
+	body            string
+	attributes      map[string]*sqs.MessageAttributeValue
+	groupID         string
+	deduplicationID string
+	sequence        string
+	sent            time.Time
+	firstReceived   time.Time
+	visibleAt       time.Time
+	receiveCount    int
+	receiptHandle   string
+	md5OfBody       string
+	md5OfAttributes string
+}
+
+// SendMessage adds a message to a queue
+func (s *SQS) SendMessage(input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error) {
+	return s.SendMessageWithContext(context.Background(), input)
+}
+
+// SendMessageWithContext adds a message to a queue
+func (s *SQS) SendMessageWithContext(ctx aws.Context, input *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.send(q, input, s.Options.Now())
+}
+
+// SendMessageBatch adds up to 10 messages to a queue
+func (s *SQS) SendMessageBatch(input *sqs.SendMessageBatchInput) (*sqs.SendMessageBatchOutput, error) {
+	return s.SendMessageBatchWithContext(context.Background(), input)
+}
+
+// SendMessageBatchWithContext adds up to 10 messages to a queue
+func (s *SQS) SendMessageBatchWithContext(ctx aws.Context, input *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]*string, len(input.Entries))
+	size := 0
+
+	for i, entry := range input.Entries {
+		ids[i] = entry.Id
+		size += payloadSize(aws.StringValue(entry.MessageBody), entry.MessageAttributes)
+	}
+
+	if err := validateBatch(ids); err != nil {
+		return nil, err
+	}
+
+	if size > 262144 {
+		return nil, awserr.New(sqs.ErrCodeBatchRequestTooLong, "Batch requests cannot be longer than 262144 bytes.", nil)
+	}
+
+	output := &sqs.SendMessageBatchOutput{}
+	now := s.Options.Now()
+
+	for _, entry := range input.Entries {
+		result, err := s.send(q, &sqs.SendMessageInput{
+			MessageBody:            entry.MessageBody,
+			MessageAttributes:      entry.MessageAttributes,
+			DelaySeconds:           entry.DelaySeconds,
+			MessageGroupId:         entry.MessageGroupId,
+			MessageDeduplicationId: entry.MessageDeduplicationId,
+		}, now)
+
+		if err != nil {
+			output.Failed = append(output.Failed, failure(entry.Id, err))
+			continue
+		}
+
+		output.Successful = append(output.Successful, &sqs.SendMessageBatchResultEntry{
+			Id:                     entry.Id,
+			MessageId:              result.MessageId,
+			MD5OfMessageBody:       result.MD5OfMessageBody,
+			MD5OfMessageAttributes: result.MD5OfMessageAttributes,
+			SequenceNumber:         result.SequenceNumber,
+		})
+	}
+
+	return output, nil
+}
+
+func (s *SQS) send(q *queue, input *sqs.SendMessageInput, now time.Time) (*sqs.SendMessageOutput, error) {
+	body := aws.StringValue(input.MessageBody)
+	if body == "" {
+		return nil, awserr.New(ErrCodeMissingParameter, "The request must contain the parameter MessageBody.", nil)
+	}
+
+	if size := payloadSize(body, input.MessageAttributes); size > q.int(sqs.QueueAttributeNameMaximumMessageSize) {
+		return nil, awserr.New(ErrCodeInvalidParameterValue, fmt.Sprintf("One or more parameters are invalid. Reason: Message must be shorter than %s bytes.", q.attributes[sqs.QueueAttributeNameMaximumMessageSize]), nil)
+	}
+
+	delay := q.duration(sqs.QueueAttributeNameDelaySeconds)
+	if input.DelaySeconds != nil {
+		seconds := aws.Int64Value(input.DelaySeconds)
+		if seconds < 0 || seconds > 900 || q.fifo() {
+			return nil, awserr.New(ErrCodeInvalidParameterValue, fmt.Sprintf("Value %d for parameter DelaySeconds is invalid.", seconds), nil)
+		}
+
+		delay = time.Duration(seconds) * time.Second
+	}
+
+	m := &message{
+		id:              newID(),
+		body:            body,
+		attributes:      input.MessageAttributes,
+		sent:            now,
+		visibleAt:       now.Add(delay),
+		md5OfBody:       md5Hex([]byte(body)),
+		md5OfAttributes: md5OfMessageAttributes(input.MessageAttributes),
+	}
+
+	if q.fifo() {
+		m.groupID = aws.StringValue(input.MessageGroupId)
+		if m.groupID == "" {
+			return nil, awserr.New(ErrCodeMissingParameter, "The request must contain the parameter MessageGroupId.", nil)
+		}
+
+		m.deduplicationID = aws.StringValue(input.MessageDeduplicationId)
+		if m.deduplicationID == "" {
+			if q.attributes[sqs.QueueAttributeNameContentBasedDeduplication] != "true" {
+				return nil, awserr.New(ErrCodeInvalidParameterValue, "The queue should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly", nil)
+			}
+
+			sum := sha256.Sum256([]byte(body))
+			m.deduplicationID = hex.EncodeToString(sum[:])
+		}
+
+		s.expire(q, now)
+		if d, ok := q.deduplication[m.deduplicationID]; ok {
+			return m.sendOutput(d.id, d.sequence), nil
+		}
+
+		q.sequence++
+		m.sequence = fmt.Sprintf("%020d", q.sequence)
+		q.deduplication[m.deduplicationID] = deduplication{id: m.id, sequence: m.sequence, expires: now.Add(DeduplicationInterval)}
+	}
+
+	q.messages = append(q.messages, m)
+	s.notify()
+
+	return m.sendOutput(m.id, m.sequence), nil
+}
+
+func (m *message) sendOutput(id, sequence string) *sqs.SendMessageOutput {
+	output := &sqs.SendMessageOutput{
+		MessageId:        aws.String(id),
+		MD5OfMessageBody: aws.String(m.md5OfBody),
+	}
+
+	if m.md5OfAttributes != "" {
+		output.MD5OfMessageAttributes = aws.String(m.md5OfAttributes)
+	}
+
+	if sequence != "" {
+		output.SequenceNumber = aws.String(sequence)
+	}
+
+	return output
+}
+
+// ReceiveMessage receives up to MaxNumberOfMessages messages from a queue, waiting up to
+// WaitTimeSeconds (or the queue's ReceiveMessageWaitTimeSeconds) for messages to be available
+func (s *SQS) ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+	return s.ReceiveMessageWithContext(context.Background(), input)
+}
+
+// ReceiveMessageWithContext receives up to MaxNumberOfMessages messages from a queue, waiting up to
+// WaitTimeSeconds (or the queue's ReceiveMessageWaitTimeSeconds) for messages to be available
+func (s *SQS) ReceiveMessageWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	max := int64(1)
+	if input.MaxNumberOfMessages != nil {
+		max = aws.Int64Value(input.MaxNumberOfMessages)
+	}
+
+	wait := q.duration(sqs.QueueAttributeNameReceiveMessageWaitTimeSeconds)
+	if input.WaitTimeSeconds != nil {
+		wait = time.Duration(aws.Int64Value(input.WaitTimeSeconds)) * time.Second
+	}
+
+	visibility := q.duration(sqs.QueueAttributeNameVisibilityTimeout)
+	if input.VisibilityTimeout != nil {
+		visibility = time.Duration(aws.Int64Value(input.VisibilityTimeout)) * time.Second
+	}
+
+	switch {
+	case max < 1 || max > 10:
+		return nil, awserr.New(ErrCodeInvalidParameterValue, fmt.Sprintf("Value %d for parameter MaxNumberOfMessages is invalid. Reason: Must be between 1 and 10.", max), nil)
+	case wait < 0 || wait > 20*time.Second:
+		return nil, awserr.New(ErrCodeInvalidParameterValue, fmt.Sprintf("Value %d for parameter WaitTimeSeconds is invalid. Reason: Must be between 0 and 20.", wait/time.Second), nil)
+	case visibility < 0 || visibility > 12*time.Hour:
+		return nil, awserr.New(ErrCodeInvalidParameterValue, fmt.Sprintf("Value %d for parameter VisibilityTimeout is invalid. Reason: Must be between 0 and 43200.", visibility/time.Second), nil)
+	}
+
+	deadline := time.Now().Add(wait)
+
+	for {
+		messages := s.receive(q, input, int(max), visibility, s.Options.Now())
+
+		remaining := time.Until(deadline)
+		if len(messages) > 0 || remaining <= 0 {
+			return &sqs.ReceiveMessageOutput{Messages: messages}, nil
+		}
+
+		if remaining > pollInterval {
+			remaining = pollInterval
+		}
+
+		changed := s.changed
+		s.mutex.Unlock()
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.mutex.Lock()
+			return nil, awserr.New(ErrCodeRequestCanceled, "request context canceled", ctx.Err())
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		s.mutex.Lock()
+
+		// the queue may have been deleted while waiting
+		if q, err = s.queue(input.QueueUrl); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// receive makes up to max visible messages invisible for the visibility timeout and returns them
+func (s *SQS) receive(q *queue, input *sqs.ReceiveMessageInput, max int, visibility time.Duration, now time.Time) []*sqs.Message {
+	s.expire(q, now)
+
+	attemptID := aws.StringValue(input.ReceiveRequestAttemptId)
+	if q.fifo() && attemptID != "" {
+		if messages, ok := s.retry(q, attemptID, input, now); ok {
+			return messages
+		}
+	}
+
+	var received []*message
+	blocked := make(map[string]bool)
+	dlq, maxReceiveCount := q.deadLetterQueue()
+
+	for _, m := range append([]*message{}, q.messages...) {
+		if len(received) == max {
+			break
+		}
+
+		if q.fifo() && blocked[m.groupID] {
+			continue
+		}
+
+		if m.visibleAt.After(now) {
+			blocked[m.groupID] = true
+			continue
+		}
+
+		if dlq != nil && dlq != q && m.receiveCount >= maxReceiveCount {
+			q.remove(m)
+			s.forget(m)
+			m.visibleAt = now
+			dlq.messages = append(dlq.messages, m)
+			s.notify()
+			continue
+		}
+
+		m.receiveCount++
+		if m.firstReceived.IsZero() {
+			m.firstReceived = now
+		}
+
+		s.forget(m)
+		m.receiptHandle = s.newReceiptHandle()
+		m.visibleAt = now.Add(visibility)
+		s.handles[m.receiptHandle] = m
+		received = append(received, m)
+	}
+
+	if q.fifo() && attemptID != "" && len(received) > 0 {
+		a := attempt{messages: received, expires: now.Add(DeduplicationInterval)}
+		for _, m := range received {
+			a.handles = append(a.handles, m.receiptHandle)
+		}
+
+		q.attempts[attemptID] = a
+	}
+
+	return s.outputs(q, received, input)
+}
+
+// retry returns the messages received by a previous request with the same attempt id if they are still in flight
+func (s *SQS) retry(q *queue, attemptID string, input *sqs.ReceiveMessageInput, now time.Time) ([]*sqs.Message, bool) {
+	a, ok := q.attempts[attemptID]
+	if !ok {
+		return nil, false
+	}
+
+	for i, m := range a.messages {
+		if m.receiptHandle != a.handles[i] || !m.visibleAt.After(now) || !contains(q.messages, m) {
+			delete(q.attempts, attemptID)
+			return nil, false
+		}
+	}
+
+	return s.outputs(q, a.messages, input), true
+}
+
+func contains(messages []*message, m *message) bool {
+	for _, candidate := range messages {
+		if candidate == m {
+			return true
+		}
+	}
+
+	return false
+}
+
+// outputs converts received messages to SDK messages with the requested attributes
+func (s *SQS) outputs(q *queue, messages []*message, input *sqs.ReceiveMessageInput) []*sqs.Message {
+	outputs := make([]*sqs.Message, len(messages))
+
+	for i, m := range messages {
+		system := map[string]string{
+			AttributeSenderId:                         SenderId,
+			AttributeSentTimestamp:                    strconv.FormatInt(m.sent.UnixNano()/int64(time.Millisecond), 10),
+			AttributeApproximateReceiveCount:          strconv.Itoa(m.receiveCount),
+			AttributeApproximateFirstReceiveTimestamp: strconv.FormatInt(m.firstReceived.UnixNano()/int64(time.Millisecond), 10),
+		}
+
+		if q.fifo() {
+			system[AttributeMessageGroupId] = m.groupID
+			system[AttributeMessageDeduplicationId] = m.deduplicationID
+			system[AttributeSequenceNumber] = m.sequence
+		}
+
+		output := &sqs.Message{
+			MessageId:     aws.String(m.id),
+			ReceiptHandle: aws.String(m.receiptHandle),
+			Body:          aws.String(m.body),
+			MD5OfBody:     aws.String(m.md5OfBody),
+		}
+
+		for _, name := range aws.StringValueSlice(input.AttributeNames) {
+			for key, value := range system {
+				if name == sqs.QueueAttributeNameAll || name == key {
+					if output.Attributes == nil {
+						output.Attributes = make(map[string]*string)
+					}
+
+					output.Attributes[key] = aws.String(value)
+				}
+			}
+		}
+
+		for key, value := range m.attributes {
+			if matchAttributeName(aws.StringValueSlice(input.MessageAttributeNames), key) {
+				if output.MessageAttributes == nil {
+					output.MessageAttributes = make(map[string]*sqs.MessageAttributeValue)
+				}
+
+				output.MessageAttributes[key] = value
+			}
+		}
+
+		if len(output.MessageAttributes) > 0 {
+			output.MD5OfMessageAttributes = aws.String(md5OfMessageAttributes(output.MessageAttributes))
+		}
+
+		outputs[i] = output
+	}
+
+	return outputs
+}
+
+// matchAttributeName returns whether a message attribute name matches one of the requested
+// names, which can be All, .*, or a prefix followed by .*
+func matchAttributeName(names []string, name string) bool {
+	for _, n := range names {
+		switch {
+		case n == sqs.QueueAttributeNameAll || n == ".*" || n == name:
+			return true
+		case strings.HasSuffix(n, ".*") && strings.HasPrefix(name, strings.TrimSuffix(n, "*")):
+			return true
+		}
+	}
+
+	return false
+}
+
+// DeleteMessage deletes a received message from a queue
+func (s *SQS) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
+	return s.DeleteMessageWithContext(context.Background(), input)
+}
+
+// DeleteMessageWithContext deletes a received message from a queue
+func (s *SQS) DeleteMessageWithContext(ctx aws.Context, input *sqs.DeleteMessageInput, opts ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.delete(q, aws.StringValue(input.ReceiptHandle)); err != nil {
+		return nil, err
+	}
+
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+// DeleteMessageBatch deletes up to 10 received messages from a queue
+func (s *SQS) DeleteMessageBatch(input *sqs.DeleteMessageBatchInput) (*sqs.DeleteMessageBatchOutput, error) {
+	return s.DeleteMessageBatchWithContext(context.Background(), input)
+}
+
+// DeleteMessageBatchWithContext deletes up to 10 received messages from a queue
+func (s *SQS) DeleteMessageBatchWithContext(ctx aws.Context, input *sqs.DeleteMessageBatchInput, opts ...request.Option) (*sqs.DeleteMessageBatchOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]*string, len(input.Entries))
+	for i, entry := range input.Entries {
+		ids[i] = entry.Id
+	}
+
+	if err := validateBatch(ids); err != nil {
+		return nil, err
+	}
+
+	output := &sqs.DeleteMessageBatchOutput{}
+
+	for _, entry := range input.Entries {
+		if err := s.delete(q, aws.StringValue(entry.ReceiptHandle)); err != nil {
+			output.Failed = append(output.Failed, failure(entry.Id, err))
+			continue
+		}
+
+		output.Successful = append(output.Successful, &sqs.DeleteMessageBatchResultEntry{Id: entry.Id})
+	}
+
+	return output, nil
+}
+
+// delete deletes the message with a receipt handle. Deleting a message that was already deleted,
+// or with a handle from an earlier receive, succeeds without effect. A handle of a message in
+// another queue is invalid.
+func (s *SQS) delete(q *queue, handle string) error {
+	m, ok := s.handles[handle]
+	if !ok {
+		if s.issued(handle) {
+			return nil
+		}
+
+		return invalidReceiptHandle(handle)
+	}
+
+	if !q.remove(m) {
+		return invalidReceiptHandle(handle)
+	}
+
+	s.forget(m)
+	s.notify()
+
+	return nil
+}
+
+// ChangeMessageVisibility sets the visibility timeout of a received message
+func (s *SQS) ChangeMessageVisibility(input *sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error) {
+	return s.ChangeMessageVisibilityWithContext(context.Background(), input)
+}
+
+// ChangeMessageVisibilityWithContext sets the visibility timeout of a received message
+func (s *SQS) ChangeMessageVisibilityWithContext(ctx aws.Context, input *sqs.ChangeMessageVisibilityInput, opts ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.changeVisibility(q, aws.StringValue(input.ReceiptHandle), aws.Int64Value(input.VisibilityTimeout)); err != nil {
+		return nil, err
+	}
+
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+// ChangeMessageVisibilityBatch sets the visibility timeout of up to 10 received messages
+func (s *SQS) ChangeMessageVisibilityBatch(input *sqs.ChangeMessageVisibilityBatchInput) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	return s.ChangeMessageVisibilityBatchWithContext(context.Background(), input)
+}
+
+// ChangeMessageVisibilityBatchWithContext sets the visibility timeout of up to 10 received messages
+func (s *SQS) ChangeMessageVisibilityBatchWithContext(ctx aws.Context, input *sqs.ChangeMessageVisibilityBatchInput, opts ...request.Option) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	q, err := s.queue(input.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]*string, len(input.Entries))
+	for i, entry := range input.Entries {
+		ids[i] = entry.Id
+	}
+
+	if err := validateBatch(ids); err != nil {
+		return nil, err
+	}
+
+	output := &sqs.ChangeMessageVisibilityBatchOutput{}
+
+	for _, entry := range input.Entries {
+		if err := s.changeVisibility(q, aws.StringValue(entry.ReceiptHandle), aws.Int64Value(entry.VisibilityTimeout)); err != nil {
+			output.Failed = append(output.Failed, failure(entry.Id, err))
+			continue
+		}
+
+		output.Successful = append(output.Successful, &sqs.ChangeMessageVisibilityBatchResultEntry{Id: entry.Id})
+	}
+
+	return output, nil
+}
+
+func (s *SQS) changeVisibility(q *queue, handle string, seconds int64) error {
+	m, ok := s.handles[handle]
+	if (!ok && !s.issued(handle)) || (ok && !contains(q.messages, m)) {
+		return invalidReceiptHandle(handle)
+	}
+
+	if seconds < 0 || seconds > 43200 {
+		return awserr.New(ErrCodeInvalidParameterValue, fmt.Sprintf("Value %d for parameter VisibilityTimeout is invalid. Reason: Must be between 0 and 43200.", seconds), nil)
+	}
+
+	now := s.Options.Now()
+	if !ok || m.receiptHandle != handle || !m.visibleAt.After(now) {
+		return awserr.New(sqs.ErrCodeMessageNotInflight, "The message referred to is not in flight.", nil)
+	}
+
+	m.visibleAt = now.Add(time.Duration(seconds) * time.Second)
+	s.notify()
+
+	return nil
+}
+
+func invalidReceiptHandle(handle string) error {
+	return awserr.New(sqs.ErrCodeReceiptHandleIsInvalid, fmt.Sprintf("The input receipt handle %q is not a valid receipt handle.", handle), nil)
+}
+
+var batchEntryID = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,80}$`)
+
+// validateBatch validates the number and ids of the entries in a batch request
+func validateBatch(ids []*string) error {
+	switch {
+	case len(ids) == 0:
+		return awserr.New(sqs.ErrCodeEmptyBatchRequest, "There should be at least one entry in the request.", nil)
+	case len(ids) > 10:
+		return awserr.New(sqs.ErrCodeTooManyEntriesInBatchRequest, fmt.Sprintf("Maximum number of entries per request are 10. You have sent %d.", len(ids)), nil)
+	}
+
+	seen := make(map[string]bool)
+
+	for _, id := range aws.StringValueSlice(ids) {
+		if !batchEntryID.MatchString(id) {
+			return awserr.New(sqs.ErrCodeInvalidBatchEntryId, "A batch entry id can only contain alphanumeric characters, hyphens and underscores. It can be at most 80 letters long.", nil)
+		}
+
+		if seen[id] {
+			return awserr.New(sqs.ErrCodeBatchEntryIdsNotDistinct, fmt.Sprintf("Id %s repeated.", id), nil)
+		}
+
+		seen[id] = true
+	}
+
+	return nil
+}
+
+// failure converts the error for a batch entry to a result entry
+func failure(id *string, err error) *sqs.BatchResultErrorEntry {
+	code, message := "InternalError", err.Error()
+	if aerr, ok := err.(awserr.Error); ok {
+		code, message = aerr.Code(), aerr.Message()
+	}
+
+	return &sqs.BatchResultErrorEntry{
+		Id:          id,
+		Code:        aws.String(code),
+		Message:     aws.String(message),
+		SenderFault: aws.Bool(true),
+	}
+}
+
+// payloadSize returns the size of a message as counted towards the maximum message size
+func payloadSize(body string, attributes map[string]*sqs.MessageAttributeValue) int {
+	size := len(body)
+
+	for name, value := range attributes {
+		size += len(name) + len(aws.StringValue(value.DataType)) + len(aws.StringValue(value.StringValue)) + len(value.BinaryValue)
+	}
+
+	return size
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// md5OfMessageAttributes computes the digest of message attributes as SQS does
+// https://docs.aws.amazon.com/AWSSimpleQueueService/latest/SQSDeveloperGuide/sqs-message-metadata.html#sqs-attributes-md5-message-digest-calculation
+func md5OfMessageAttributes(attributes map[string]*sqs.MessageAttributeValue) string {
+	if len(attributes) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var buf []byte
+	field := func(value []byte) {
+		length := make([]byte, 4)
+		binary.BigEndian.PutUint32(length, uint32(len(value)))
+		buf = append(append(buf, length...), value...)
+	}
+
+	for _, name := range names {
+		value := attributes[name]
+		field([]byte(name))
+		field([]byte(aws.StringValue(value.DataType)))
+
+		if value.BinaryValue != nil {
+			buf = append(buf, 2)
+			field(value.BinaryValue)
+		} else {
+			buf = append(buf, 1)
+			field([]byte(aws.StringValue(value.StringValue)))
+		}
+	}
+
+	return md5Hex(buf)
+}
+
+func newID() string {
+	b := random(16)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// newReceiptHandle returns a random receipt handle signed with the secret
+func (s *SQS) newReceiptHandle() string {
+	nonce := random(32)
+	return base64.RawURLEncoding.EncodeToString(append(nonce, s.sign(nonce)...))
+}
+
+// issued returns whether a receipt handle was returned by a receive, even if it is no longer tracked
+func (s *SQS) issued(handle string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(handle)
+	if err != nil || len(b) != 48 {
+		return false
+	}
+
+	return hmac.Equal(b[32:], s.sign(b[:32]))
+}
+
+func (s *SQS) sign(nonce []byte) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(nonce)
+	return mac.Sum(nil)[:16]
+}
+
+// forget stops tracking the receipt handles of messages that were deleted or received again
+func (s *SQS) forget(messages ...*message) {
+	for _, m := range messages {
+		if m.receiptHandle != "" {
+			delete(s.handles, m.receiptHandle)
+		}
+	}
+}
+
+// expire deletes the messages of a queue that are older than its retention period
+func (s *SQS) expire(q *queue, now time.Time) {
+	s.forget(q.expire(now)...)
+}
+
+func random(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return b
+}
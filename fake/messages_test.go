@@ -0,0 +1,276 @@
+package fake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+func send(t *testing.T, s *SQS, url *string, body string) string {
+	output, err := s.SendMessage(&sqs.SendMessageInput{QueueUrl: url, MessageBody: aws.String(body)})
+	assert.NoError(t, err)
+
+	return aws.StringValue(output.MessageId)
+}
+
+func receive(t *testing.T, s *SQS, input *sqs.ReceiveMessageInput) []*sqs.Message {
+	output, err := s.ReceiveMessage(input)
+	assert.NoError(t, err)
+
+	return output.Messages
+}
+
+func TestVisibility(t *testing.T) {
+	s, c := setup(t)
+	url := createQueue(t, s, "queue", map[string]string{"VisibilityTimeout": "30"})
+	id := send(t, s, url, "hello")
+
+	messages := receive(t, s, &sqs.ReceiveMessageInput{
+		QueueUrl:       url,
+		AttributeNames: aws.StringSlice([]string{"ApproximateReceiveCount"}),
+	})
+	assert.Len(t, messages, 1)
+	assert.Equal(t, id, aws.StringValue(messages[0].MessageId))
+	assert.Equal(t, "hello", aws.StringValue(messages[0].Body))
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", aws.StringValue(messages[0].MD5OfBody))
+	assert.Equal(t, map[string]string{"ApproximateReceiveCount": "1"}, aws.StringValueMap(messages[0].Attributes))
+
+	assert.Empty(t, receive(t, s, &sqs.ReceiveMessageInput{QueueUrl: url}))
+
+	c.Advance(30 * time.Second)
+	messages = receive(t, s, &sqs.ReceiveMessageInput{
+		QueueUrl:          url,
+		VisibilityTimeout: aws.Int64(0),
+		AttributeNames:    aws.StringSlice([]string{"All"}),
+	})
+	assert.Equal(t, "2", aws.StringValue(messages[0].Attributes["ApproximateReceiveCount"]))
+
+	messages = receive(t, s, &sqs.ReceiveMessageInput{QueueUrl: url})
+	_, err := s.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          url,
+		ReceiptHandle:     messages[0].ReceiptHandle,
+		VisibilityTimeout: aws.Int64(0),
+	})
+	assert.NoError(t, err)
+
+	_, err = s.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          url,
+		ReceiptHandle:     messages[0].ReceiptHandle,
+		VisibilityTimeout: aws.Int64(10),
+	})
+	assert.Equal(t, sqs.ErrCodeMessageNotInflight, code(err))
+
+	messages = receive(t, s, &sqs.ReceiveMessageInput{QueueUrl: url})
+	_, err = s.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: url, ReceiptHandle: messages[0].ReceiptHandle})
+	assert.NoError(t, err)
+
+	c.Advance(time.Hour)
+	assert.Empty(t, receive(t, s, &sqs.ReceiveMessageInput{QueueUrl: url}))
+}
+
+func TestLongPoll(t *testing.T) {
+	s := New(Options{})
+	url := createQueue(t, s, "queue", nil)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		send(t, s, url, "hello")
+	}()
+
+	messages := receive(t, s, &sqs.ReceiveMessageInput{QueueUrl: url, WaitTimeSeconds: aws.Int64(20)})
+	assert.Len(t, messages, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := s.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{QueueUrl: url, WaitTimeSeconds: aws.Int64(20)})
+	assert.Equal(t, ErrCodeRequestCanceled, code(err))
+}
+
+func TestBatch(t *testing.T) {
+	s, _ := setup(t)
+	url := createQueue(t, s, "queue", nil)
+
+	sent, err := s.SendMessageBatch(&sqs.SendMessageBatchInput{
+		QueueUrl: url,
+		Entries: []*sqs.SendMessageBatchRequestEntry{
+			{Id: aws.String("a"), MessageBody: aws.String("a")},
+			{Id: aws.String("b"), MessageBody: aws.String("")},
+			{Id: aws.String("c"), MessageBody: aws.String("c"), MessageAttributes: map[string]*sqs.MessageAttributeValue{
+				"color": {DataType: aws.String("String"), StringValue: aws.String("blue")},
+			}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, sent.Successful, 2)
+	assert.Equal(t, "b", aws.StringValue(sent.Failed[0].Id))
+	assert.Equal(t, ErrCodeMissingParameter, aws.StringValue(sent.Failed[0].Code))
+
+	messages := receive(t, s, &sqs.ReceiveMessageInput{
+		QueueUrl:              url,
+		MaxNumberOfMessages:   aws.Int64(10),
+		MessageAttributeNames: aws.StringSlice([]string{"All"}),
+	})
+	assert.Len(t, messages, 2)
+	assert.Equal(t, "blue", aws.StringValue(messages[1].MessageAttributes["color"].StringValue))
+	assert.Equal(t, aws.StringValue(sent.Successful[1].MD5OfMessageAttributes), aws.StringValue(messages[1].MD5OfMessageAttributes))
+
+	deleted, err := s.DeleteMessageBatch(&sqs.DeleteMessageBatchInput{
+		QueueUrl: url,
+		Entries: []*sqs.DeleteMessageBatchRequestEntry{
+			{Id: aws.String("0"), ReceiptHandle: messages[0].ReceiptHandle},
+			{Id: aws.String("1"), ReceiptHandle: aws.String("invalid")},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, deleted.Successful, 1)
+	assert.Equal(t, sqs.ErrCodeReceiptHandleIsInvalid, aws.StringValue(deleted.Failed[0].Code))
+
+	changed, err := s.ChangeMessageVisibilityBatch(&sqs.ChangeMessageVisibilityBatchInput{
+		QueueUrl: url,
+		Entries: []*sqs.ChangeMessageVisibilityBatchRequestEntry{
+			{Id: aws.String("0"), ReceiptHandle: messages[0].ReceiptHandle, VisibilityTimeout: aws.Int64(0)},
+			{Id: aws.String("1"), ReceiptHandle: messages[1].ReceiptHandle, VisibilityTimeout: aws.Int64(0)},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", aws.StringValue(changed.Successful[0].Id))
+	assert.Equal(t, sqs.ErrCodeMessageNotInflight, aws.StringValue(changed.Failed[0].Code))
+
+	_, err = s.DeleteMessageBatch(&sqs.DeleteMessageBatchInput{
+		QueueUrl: url,
+		Entries: []*sqs.DeleteMessageBatchRequestEntry{
+			{Id: aws.String("0"), ReceiptHandle: messages[0].ReceiptHandle},
+			{Id: aws.String("0"), ReceiptHandle: messages[1].ReceiptHandle},
+		},
+	})
+	assert.Equal(t, sqs.ErrCodeBatchEntryIdsNotDistinct, code(err))
+}
+
+func TestReceiptHandles(t *testing.T) {
+	s, _ := setup(t)
+	url := createQueue(t, s, "queue", map[string]string{"VisibilityTimeout": "0"})
+	send(t, s, url, "a")
+	send(t, s, url, "b")
+
+	stale := receive(t, s, &sqs.ReceiveMessageInput{QueueUrl: url, MaxNumberOfMessages: aws.Int64(10)})
+	messages := receive(t, s, &sqs.ReceiveMessageInput{QueueUrl: url, MaxNumberOfMessages: aws.Int64(10), VisibilityTimeout: aws.Int64(30)})
+	assert.Len(t, s.handles, 2, "handles from earlier receives are forgotten")
+
+	_, err := s.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: url, ReceiptHandle: stale[0].ReceiptHandle})
+	assert.NoError(t, err, "stale handles can be deleted")
+	assert.Len(t, s.handles, 2, "deleting with a stale handle has no effect")
+
+	_, err = s.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: url, ReceiptHandle: messages[0].ReceiptHandle})
+	assert.NoError(t, err)
+	assert.Len(t, s.handles, 1)
+
+	_, err = s.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: url, ReceiptHandle: messages[0].ReceiptHandle})
+	assert.NoError(t, err, "deleted messages can be deleted again")
+
+	_, err = s.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{QueueUrl: url, ReceiptHandle: messages[0].ReceiptHandle, VisibilityTimeout: aws.Int64(0)})
+	assert.Equal(t, sqs.ErrCodeMessageNotInflight, err.(awserr.Error).Code())
+
+	other := createQueue(t, s, "other", nil)
+	_, err = s.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{QueueUrl: other, ReceiptHandle: messages[1].ReceiptHandle, VisibilityTimeout: aws.Int64(0)})
+	assert.Equal(t, sqs.ErrCodeReceiptHandleIsInvalid, err.(awserr.Error).Code(), "handles are only valid for their queue")
+
+	output, err := s.DeleteMessageBatch(&sqs.DeleteMessageBatchInput{
+		QueueUrl: other,
+		Entries:  []*sqs.DeleteMessageBatchRequestEntry{{Id: aws.String("0"), ReceiptHandle: messages[1].ReceiptHandle}},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, output.Successful)
+	assert.Equal(t, sqs.ErrCodeReceiptHandleIsInvalid, aws.StringValue(output.Failed[0].Code))
+	assert.Len(t, s.handles, 1, "the message stays in flight")
+
+	_, err = s.PurgeQueue(&sqs.PurgeQueueInput{QueueUrl: url})
+	assert.NoError(t, err)
+	assert.Empty(t, s.handles)
+
+	send(t, s, url, "c")
+	receive(t, s, &sqs.ReceiveMessageInput{QueueUrl: url})
+	_, err = s.DeleteQueue(&sqs.DeleteQueueInput{QueueUrl: url})
+	assert.NoError(t, err)
+	assert.Empty(t, s.handles)
+}
+
+func TestRedrive(t *testing.T) {
+	s, _ := setup(t)
+	dlq := createQueue(t, s, "dlq", nil)
+	url := createQueue(t, s, "queue", map[string]string{
+		"RedrivePolicy": `{"deadLetterTargetArn":"arn:aws:sqs:us-east-1:000000000000:dlq","maxReceiveCount":"2"}`,
+	})
+	id := send(t, s, url, "poison")
+
+	var received []*sqs.Message
+	for i := 0; i < 2; i++ {
+		received = receive(t, s, &sqs.ReceiveMessageInput{QueueUrl: url, VisibilityTimeout: aws.Int64(0)})
+		assert.Len(t, received, 1)
+	}
+
+	assert.Empty(t, receive(t, s, &sqs.ReceiveMessageInput{QueueUrl: url}))
+
+	_, err := s.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: dlq, ReceiptHandle: received[0].ReceiptHandle})
+	assert.NoError(t, err, "the handle from before the redrive has no effect")
+
+	messages := receive(t, s, &sqs.ReceiveMessageInput{QueueUrl: dlq})
+	assert.Equal(t, id, aws.StringValue(messages[0].MessageId))
+}
+
+func TestFIFO(t *testing.T) {
+	s, _ := setup(t)
+	url := createQueue(t, s, "queue.fifo", map[string]string{
+		"FifoQueue":                 "true",
+		"ContentBasedDeduplication": "true",
+	})
+
+	for _, m := range [][2]string{{"a", "a1"}, {"a", "a2"}, {"b", "b1"}, {"a", "a1"}} {
+		_, err := s.SendMessage(&sqs.SendMessageInput{
+			QueueUrl:       url,
+			MessageBody:    aws.String(m[1]),
+			MessageGroupId: aws.String(m[0]),
+		})
+		assert.NoError(t, err)
+	}
+
+	_, err := s.SendMessage(&sqs.SendMessageInput{QueueUrl: url, MessageBody: aws.String("x")})
+	assert.Equal(t, ErrCodeMissingParameter, code(err))
+
+	bodies := func(messages []*sqs.Message) []string {
+		var result []string
+		for _, m := range messages {
+			result = append(result, aws.StringValue(m.Body))
+		}
+
+		return result
+	}
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl:                url,
+		MaxNumberOfMessages:     aws.Int64(1),
+		ReceiveRequestAttemptId: aws.String("attempt"),
+		AttributeNames:          aws.StringSlice([]string{"SequenceNumber"}),
+	}
+
+	first := receive(t, s, input)
+	assert.Equal(t, []string{"a1"}, bodies(first))
+	assert.Equal(t, "00000000000000000001", aws.StringValue(first[0].Attributes["SequenceNumber"]))
+
+	retried := receive(t, s, input)
+	assert.Equal(t, first[0].ReceiptHandle, retried[0].ReceiptHandle)
+
+	messages := receive(t, s, &sqs.ReceiveMessageInput{QueueUrl: url, MaxNumberOfMessages: aws.Int64(10)})
+	assert.Equal(t, []string{"b1"}, bodies(messages))
+
+	_, err = s.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: url, ReceiptHandle: first[0].ReceiptHandle})
+	assert.NoError(t, err)
+
+	messages = receive(t, s, &sqs.ReceiveMessageInput{QueueUrl: url, MaxNumberOfMessages: aws.Int64(10)})
+	assert.Equal(t, []string{"a2"}, bodies(messages))
+}
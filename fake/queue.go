@@ -0,0 +1,263 @@
+package fake
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/bendrucker/sqs-receive-channel/pkg/redrive"
+)
+
+// DeduplicationInterval is how long FIFO queues remember message deduplication ids
+const DeduplicationInterval = 5 * time.Minute
+
+// queue is a queue and its messages
+type queue struct {
+	sqs  *SQS
+	name string
+	url  string
+	arn  string
+
+	attributes map[string]string
+	created    time.Time
+	modified   time.Time
+
+	// messages are kept in the order they were sent
+	messages      []*message
+	sequence      int64
+	deduplication map[string]deduplication
+	attempts      map[string]attempt
+}
+
+// deduplication is a message id remembered for a FIFO deduplication id
+type deduplication struct {
+	id       string
+	sequence string
+	expires  time.Time
+}
+
+// attempt is the result of a FIFO receive request that can be retried with the same attempt id
+type attempt struct {
+	messages []*message
+	handles  []string
+	expires  time.Time
+}
+
+// defaults are the attributes of a queue that are not set when it is created
+var defaults = map[string]string{
+	sqs.QueueAttributeNameDelaySeconds:                  "0",
+	sqs.QueueAttributeNameMaximumMessageSize:            "262144",
+	sqs.QueueAttributeNameMessageRetentionPeriod:        "345600",
+	sqs.QueueAttributeNameReceiveMessageWaitTimeSeconds: "0",
+	sqs.QueueAttributeNameVisibilityTimeout:             "30",
+}
+
+// limits are the valid ranges of numeric attributes
+var limits = map[string][2]int64{
+	sqs.QueueAttributeNameDelaySeconds:                  {0, 900},
+	sqs.QueueAttributeNameMaximumMessageSize:            {1024, 262144},
+	sqs.QueueAttributeNameMessageRetentionPeriod:        {60, 1209600},
+	sqs.QueueAttributeNameReceiveMessageWaitTimeSeconds: {0, 20},
+	sqs.QueueAttributeNameVisibilityTimeout:             {0, 43200},
+}
+
+func newQueue(s *SQS, name string, now time.Time) *queue {
+	q := &queue{
+		sqs:           s,
+		name:          name,
+		url:           fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(s.Options.Endpoint, "/"), s.Options.AccountID, name),
+		arn:           fmt.Sprintf("arn:aws:sqs:%s:%s:%s", s.Options.Region, s.Options.AccountID, name),
+		attributes:    make(map[string]string),
+		created:       now,
+		modified:      now,
+		deduplication: make(map[string]deduplication),
+		attempts:      make(map[string]attempt),
+	}
+
+	for key, value := range defaults {
+		q.attributes[key] = value
+	}
+
+	if strings.HasSuffix(name, ".fifo") {
+		q.attributes[sqs.QueueAttributeNameFifoQueue] = "true"
+		q.attributes[sqs.QueueAttributeNameContentBasedDeduplication] = "false"
+	}
+
+	return q
+}
+
+func (q *queue) fifo() bool {
+	return q.attributes[sqs.QueueAttributeNameFifoQueue] == "true"
+}
+
+// int returns the value of a numeric attribute
+func (q *queue) int(name string) int {
+	n, _ := strconv.Atoi(q.attributes[name])
+	return n
+}
+
+// duration returns the value of an attribute that is a number of seconds
+func (q *queue) duration(name string) time.Duration {
+	return time.Duration(q.int(name)) * time.Second
+}
+
+// setAttributes validates and sets queue attributes. FifoQueue can only be set when the queue is created.
+func (q *queue) setAttributes(attributes map[string]*string, create bool) error {
+	for name, v := range attributes {
+		value := ""
+		if v != nil {
+			value = *v
+		}
+
+		switch name {
+		case sqs.QueueAttributeNameFifoQueue:
+			if !create || value != q.attributes[name] {
+				return invalidAttributeValue(name)
+			}
+		case sqs.QueueAttributeNameContentBasedDeduplication:
+			if !q.fifo() || (value != "true" && value != "false") {
+				return invalidAttributeValue(name)
+			}
+		case sqs.QueueAttributeNameRedrivePolicy:
+			if value != "" {
+				if _, err := redrive.Parse(value); err != nil {
+					return invalidAttributeValue(name)
+				}
+			}
+		case sqs.QueueAttributeNamePolicy:
+		default:
+			limit, ok := limits[name]
+			if !ok {
+				return awserr.New(sqs.ErrCodeInvalidAttributeName, fmt.Sprintf("Unknown Attribute %s.", name), nil)
+			}
+
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < limit[0] || n > limit[1] {
+				return invalidAttributeValue(name)
+			}
+		}
+
+		q.attributes[name] = value
+	}
+
+	return nil
+}
+
+func invalidAttributeValue(name string) error {
+	return awserr.New(ErrCodeInvalidParameterValue, fmt.Sprintf("Invalid value for the parameter %s.", name), nil)
+}
+
+// getAttributes returns the requested attributes, including computed attributes
+func (q *queue) getAttributes(names []string, now time.Time) (map[string]string, error) {
+	all := map[string]string{
+		sqs.QueueAttributeNameQueueArn:              q.arn,
+		sqs.QueueAttributeNameCreatedTimestamp:      strconv.FormatInt(q.created.Unix(), 10),
+		sqs.QueueAttributeNameLastModifiedTimestamp: strconv.FormatInt(q.modified.Unix(), 10),
+	}
+
+	for name, value := range q.attributes {
+		all[name] = value
+	}
+
+	var visible, inflight, delayed int
+	for _, m := range q.messages {
+		switch {
+		case !m.visibleAt.After(now):
+			visible++
+		case m.receiveCount > 0:
+			inflight++
+		default:
+			delayed++
+		}
+	}
+
+	all[sqs.QueueAttributeNameApproximateNumberOfMessages] = strconv.Itoa(visible)
+	all[sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible] = strconv.Itoa(inflight)
+	all[sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed] = strconv.Itoa(delayed)
+
+	result := make(map[string]string)
+
+	for _, name := range names {
+		if name == sqs.QueueAttributeNameAll {
+			return all, nil
+		}
+
+		value, ok := all[name]
+		if !ok {
+			return nil, awserr.New(sqs.ErrCodeInvalidAttributeName, fmt.Sprintf("Unknown Attribute %s.", name), nil)
+		}
+
+		result[name] = value
+	}
+
+	return result, nil
+}
+
+// deadLetterQueue returns the dead-letter queue and the maximum receive count from the
+// queue's redrive policy, or nil if the policy is not set or its queue does not exist
+func (q *queue) deadLetterQueue() (*queue, int) {
+	value := q.attributes[sqs.QueueAttributeNameRedrivePolicy]
+	if value == "" {
+		return nil, 0
+	}
+
+	policy, err := redrive.Parse(value)
+	if err != nil {
+		return nil, 0
+	}
+
+	for _, dlq := range q.sqs.queues {
+		if dlq.arn == policy.DeadLetterTargetArn {
+			return dlq, policy.MaxReceiveCount
+		}
+	}
+
+	return nil, 0
+}
+
+// remove deletes a message from the queue and returns whether it was present
+func (q *queue) remove(m *message) bool {
+	for i, candidate := range q.messages {
+		if candidate == m {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// expire deletes messages that are older than the retention period and forgets expired
+// deduplication ids and receive attempts. It returns the deleted messages.
+func (q *queue) expire(now time.Time) []*message {
+	retention := q.duration(sqs.QueueAttributeNameMessageRetentionPeriod)
+	messages := q.messages[:0]
+	var expired []*message
+
+	for _, m := range q.messages {
+		if now.Sub(m.sent) < retention {
+			messages = append(messages, m)
+		} else {
+			expired = append(expired, m)
+		}
+	}
+
+	q.messages = messages
+
+	for id, d := range q.deduplication {
+		if !now.Before(d.expires) {
+			delete(q.deduplication, id)
+		}
+	}
+
+	for id, a := range q.attempts {
+		if !now.Before(a.expires) {
+			delete(q.attempts, id)
+		}
+	}
+
+	return expired
+}
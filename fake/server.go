@@ -0,0 +1,664 @@
+package fake
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// ResetPath is the path that deletes every queue when it receives a POST request
+const ResetPath = "/_sqsch/reset"
+
+// namespace is the XML namespace of SQS query protocol responses
+const namespace = "http://queue.amazonaws.com/doc/2012-11-05/"
+
+// jsonTargetPrefix prefixes the X-Amz-Target header of JSON protocol requests
+const jsonTargetPrefix = "AmazonSQS."
+
+// Reset deletes every queue
+func (s *SQS) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.queues = make(map[string]*queue)
+	s.handles = make(map[string]*message)
+	s.notify()
+}
+
+// ServeHTTP serves the SQS API over HTTP so that unmodified SDK clients can use the fake by
+// setting their endpoint to the server's URL. It supports the query protocol (form encoded
+// requests and XML responses) as well as the JSON protocol (requests with an X-Amz-Target header).
+// A POST request to ResetPath deletes every queue.
+func (s *SQS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == ResetPath && r.Method == http.MethodPost {
+		s.Reset()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if target := r.Header.Get("X-Amz-Target"); strings.HasPrefix(target, jsonTargetPrefix) {
+		s.serveJSON(w, r, strings.TrimPrefix(target, jsonTargetPrefix))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeXMLError(w, awserr.New(ErrCodeInvalidParameterValue, err.Error(), nil))
+		return
+	}
+
+	action := r.Form.Get("Action")
+	output, err := s.query(r, action, r.Form)
+	if err != nil {
+		writeXMLError(w, err)
+		return
+	}
+
+	writeXML(w, http.StatusOK, &response{
+		XMLName:  xml.Name{Space: namespace, Local: action + "Response"},
+		Result:   output,
+		Metadata: metadata{RequestId: newID()},
+	})
+}
+
+// query calls the action of a query protocol request and returns its XML result
+func (s *SQS) query(r *http.Request, action string, form url.Values) (interface{}, error) {
+	ctx := r.Context()
+	name := xml.Name{Local: action + "Result"}
+	queueURL := optional(form, "QueueUrl")
+
+	switch action {
+	case "CreateQueue":
+		output, err := s.CreateQueueWithContext(ctx, &sqs.CreateQueueInput{
+			QueueName:  optional(form, "QueueName"),
+			Attributes: attributeMap(form, "Attribute"),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return result{XMLName: name, QueueUrl: output.QueueUrl}, nil
+	case "GetQueueUrl":
+		output, err := s.GetQueueUrlWithContext(ctx, &sqs.GetQueueUrlInput{QueueName: optional(form, "QueueName")})
+		if err != nil {
+			return nil, err
+		}
+
+		return result{XMLName: name, QueueUrl: output.QueueUrl}, nil
+	case "DeleteQueue":
+		_, err := s.DeleteQueueWithContext(ctx, &sqs.DeleteQueueInput{QueueUrl: queueURL})
+		return result{XMLName: name}, err
+	case "PurgeQueue":
+		_, err := s.PurgeQueueWithContext(ctx, &sqs.PurgeQueueInput{QueueUrl: queueURL})
+		return result{XMLName: name}, err
+	case "ListQueues":
+		output, err := s.ListQueuesWithContext(ctx, &sqs.ListQueuesInput{QueueNamePrefix: optional(form, "QueueNamePrefix")})
+		if err != nil {
+			return nil, err
+		}
+
+		return listQueuesResult{XMLName: name, QueueUrls: aws.StringValueSlice(output.QueueUrls)}, nil
+	case "GetQueueAttributes":
+		output, err := s.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       queueURL,
+			AttributeNames: list(form, "AttributeName"),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return result{XMLName: name, Attributes: attributeList(output.Attributes)}, nil
+	case "SetQueueAttributes":
+		_, err := s.SetQueueAttributesWithContext(ctx, &sqs.SetQueueAttributesInput{
+			QueueUrl:   queueURL,
+			Attributes: attributeMap(form, "Attribute"),
+		})
+		return result{XMLName: name}, err
+	case "SendMessage":
+		input := &sqs.SendMessageInput{
+			QueueUrl:               queueURL,
+			MessageBody:            optional(form, "MessageBody"),
+			MessageGroupId:         optional(form, "MessageGroupId"),
+			MessageDeduplicationId: optional(form, "MessageDeduplicationId"),
+		}
+
+		var err error
+		if input.DelaySeconds, err = integer(form, "DelaySeconds"); err != nil {
+			return nil, err
+		}
+
+		if input.MessageAttributes, err = messageAttributes(form, "MessageAttribute"); err != nil {
+			return nil, err
+		}
+
+		output, err := s.SendMessageWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		return result{
+			XMLName:                name,
+			MessageId:              output.MessageId,
+			MD5OfMessageBody:       output.MD5OfMessageBody,
+			MD5OfMessageAttributes: output.MD5OfMessageAttributes,
+			SequenceNumber:         output.SequenceNumber,
+		}, nil
+	case "SendMessageBatch":
+		input := &sqs.SendMessageBatchInput{QueueUrl: queueURL}
+
+		for _, prefix := range entries(form, "SendMessageBatchRequestEntry") {
+			entry := &sqs.SendMessageBatchRequestEntry{
+				Id:                     optional(form, prefix+"Id"),
+				MessageBody:            optional(form, prefix+"MessageBody"),
+				MessageGroupId:         optional(form, prefix+"MessageGroupId"),
+				MessageDeduplicationId: optional(form, prefix+"MessageDeduplicationId"),
+			}
+
+			var err error
+			if entry.DelaySeconds, err = integer(form, prefix+"DelaySeconds"); err != nil {
+				return nil, err
+			}
+
+			if entry.MessageAttributes, err = messageAttributes(form, prefix+"MessageAttribute"); err != nil {
+				return nil, err
+			}
+
+			input.Entries = append(input.Entries, entry)
+		}
+
+		output, err := s.SendMessageBatchWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		res := result{XMLName: name, Failed: output.Failed}
+		for _, entry := range output.Successful {
+			res.SendSuccessful = append(res.SendSuccessful, sendResultEntry{
+				Id:                     entry.Id,
+				MessageId:              entry.MessageId,
+				MD5OfMessageBody:       entry.MD5OfMessageBody,
+				MD5OfMessageAttributes: entry.MD5OfMessageAttributes,
+				SequenceNumber:         entry.SequenceNumber,
+			})
+		}
+
+		return res, nil
+	case "ReceiveMessage":
+		input := &sqs.ReceiveMessageInput{
+			QueueUrl:                queueURL,
+			AttributeNames:          list(form, "AttributeName"),
+			MessageAttributeNames:   list(form, "MessageAttributeName"),
+			ReceiveRequestAttemptId: optional(form, "ReceiveRequestAttemptId"),
+		}
+
+		var err error
+		if input.MaxNumberOfMessages, err = integer(form, "MaxNumberOfMessages"); err != nil {
+			return nil, err
+		}
+
+		if input.VisibilityTimeout, err = integer(form, "VisibilityTimeout"); err != nil {
+			return nil, err
+		}
+
+		if input.WaitTimeSeconds, err = integer(form, "WaitTimeSeconds"); err != nil {
+			return nil, err
+		}
+
+		output, err := s.ReceiveMessageWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		res := result{XMLName: name}
+		for _, m := range output.Messages {
+			res.Messages = append(res.Messages, xmlMessage(m))
+		}
+
+		return res, nil
+	case "DeleteMessage":
+		_, err := s.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      queueURL,
+			ReceiptHandle: optional(form, "ReceiptHandle"),
+		})
+		return result{XMLName: name}, err
+	case "DeleteMessageBatch":
+		input := &sqs.DeleteMessageBatchInput{QueueUrl: queueURL}
+
+		for _, prefix := range entries(form, "DeleteMessageBatchRequestEntry") {
+			input.Entries = append(input.Entries, &sqs.DeleteMessageBatchRequestEntry{
+				Id:            optional(form, prefix+"Id"),
+				ReceiptHandle: optional(form, prefix+"ReceiptHandle"),
+			})
+		}
+
+		output, err := s.DeleteMessageBatchWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		res := result{XMLName: name, Failed: output.Failed}
+		for _, entry := range output.Successful {
+			res.DeleteSuccessful = append(res.DeleteSuccessful, idEntry{Id: entry.Id})
+		}
+
+		return res, nil
+	case "ChangeMessageVisibility":
+		timeout, err := integer(form, "VisibilityTimeout")
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = s.ChangeMessageVisibilityWithContext(ctx, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          queueURL,
+			ReceiptHandle:     optional(form, "ReceiptHandle"),
+			VisibilityTimeout: timeout,
+		})
+		return result{XMLName: name}, err
+	case "ChangeMessageVisibilityBatch":
+		input := &sqs.ChangeMessageVisibilityBatchInput{QueueUrl: queueURL}
+
+		for _, prefix := range entries(form, "ChangeMessageVisibilityBatchRequestEntry") {
+			timeout, err := integer(form, prefix+"VisibilityTimeout")
+			if err != nil {
+				return nil, err
+			}
+
+			input.Entries = append(input.Entries, &sqs.ChangeMessageVisibilityBatchRequestEntry{
+				Id:                optional(form, prefix+"Id"),
+				ReceiptHandle:     optional(form, prefix+"ReceiptHandle"),
+				VisibilityTimeout: timeout,
+			})
+		}
+
+		output, err := s.ChangeMessageVisibilityBatchWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		res := result{XMLName: name, Failed: output.Failed}
+		for _, entry := range output.Successful {
+			res.ChangeSuccessful = append(res.ChangeSuccessful, idEntry{Id: entry.Id})
+		}
+
+		return res, nil
+	default:
+		return nil, awserr.New("InvalidAction", fmt.Sprintf("The action %s is not valid for this endpoint.", action), nil)
+	}
+}
+
+// response is the body of a successful query protocol response
+type response struct {
+	XMLName  xml.Name
+	Result   interface{}
+	Metadata metadata `xml:"ResponseMetadata"`
+}
+
+type metadata struct {
+	RequestId string
+}
+
+// result is the union of the results of every supported action
+type result struct {
+	XMLName xml.Name
+
+	QueueUrl   *string           `xml:",omitempty"`
+	Attributes []attribute       `xml:"Attribute,omitempty"`
+	Messages   []receivedMessage `xml:"Message,omitempty"`
+
+	MessageId              *string `xml:",omitempty"`
+	MD5OfMessageBody       *string `xml:",omitempty"`
+	MD5OfMessageAttributes *string `xml:",omitempty"`
+	SequenceNumber         *string `xml:",omitempty"`
+
+	SendSuccessful   []sendResultEntry            `xml:"SendMessageBatchResultEntry,omitempty"`
+	DeleteSuccessful []idEntry                    `xml:"DeleteMessageBatchResultEntry,omitempty"`
+	ChangeSuccessful []idEntry                    `xml:"ChangeMessageVisibilityBatchResultEntry,omitempty"`
+	Failed           []*sqs.BatchResultErrorEntry `xml:"BatchResultErrorEntry,omitempty"`
+}
+
+// listQueuesResult is the result of ListQueues, whose QueueUrl elements are a list
+type listQueuesResult struct {
+	XMLName   xml.Name
+	QueueUrls []string `xml:"QueueUrl"`
+}
+
+type attribute struct {
+	Name  string
+	Value string
+}
+
+// receivedMessage is a received message in a query protocol response
+type receivedMessage struct {
+	MessageId              *string
+	ReceiptHandle          *string
+	MD5OfBody              *string
+	Body                   *string
+	MD5OfMessageAttributes *string            `xml:",omitempty"`
+	Attributes             []attribute        `xml:"Attribute,omitempty"`
+	MessageAttributes      []messageAttribute `xml:"MessageAttribute,omitempty"`
+}
+
+type messageAttribute struct {
+	Name  string
+	Value messageAttributeValue
+}
+
+type messageAttributeValue struct {
+	DataType    *string
+	StringValue *string `xml:",omitempty"`
+	BinaryValue *string `xml:",omitempty"`
+}
+
+type sendResultEntry struct {
+	Id                     *string
+	MessageId              *string
+	MD5OfMessageBody       *string
+	MD5OfMessageAttributes *string `xml:",omitempty"`
+	SequenceNumber         *string `xml:",omitempty"`
+}
+
+type idEntry struct {
+	Id *string
+}
+
+func xmlMessage(m *sqs.Message) receivedMessage {
+	result := receivedMessage{
+		MessageId:              m.MessageId,
+		ReceiptHandle:          m.ReceiptHandle,
+		MD5OfBody:              m.MD5OfBody,
+		Body:                   m.Body,
+		MD5OfMessageAttributes: m.MD5OfMessageAttributes,
+		Attributes:             attributeList(m.Attributes),
+	}
+
+	names := make([]string, 0, len(m.MessageAttributes))
+	for name := range m.MessageAttributes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := m.MessageAttributes[name]
+		attr := messageAttribute{Name: name, Value: messageAttributeValue{DataType: value.DataType, StringValue: value.StringValue}}
+
+		if value.BinaryValue != nil {
+			attr.Value.BinaryValue = aws.String(base64.StdEncoding.EncodeToString(value.BinaryValue))
+		}
+
+		result.MessageAttributes = append(result.MessageAttributes, attr)
+	}
+
+	return result
+}
+
+func attributeList(attributes map[string]*string) []attribute {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	result := make([]attribute, len(names))
+	for i, name := range names {
+		result[i] = attribute{Name: name, Value: aws.StringValue(attributes[name])}
+	}
+
+	return result
+}
+
+// errorResponse is the body of a failed query protocol response
+type errorResponse struct {
+	XMLName   xml.Name `xml:"ErrorResponse"`
+	Error     errorDetail
+	RequestId string
+}
+
+type errorDetail struct {
+	Type    string
+	Code    string
+	Message string
+}
+
+func writeXML(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(body)
+}
+
+func writeXMLError(w http.ResponseWriter, err error) {
+	code, message := errorCode(err)
+
+	writeXML(w, http.StatusBadRequest, &errorResponse{
+		Error:     errorDetail{Type: "Sender", Code: code, Message: message},
+		RequestId: newID(),
+	})
+}
+
+func errorCode(err error) (string, string) {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code(), aerr.Message()
+	}
+
+	return "InternalError", err.Error()
+}
+
+// optional returns the value of a form parameter or nil if it is not set
+func optional(form url.Values, key string) *string {
+	if values, ok := form[key]; ok && len(values) > 0 {
+		return aws.String(values[0])
+	}
+
+	return nil
+}
+
+// integer returns the value of an integer form parameter or nil if it is not set
+func integer(form url.Values, key string) (*int64, error) {
+	value := optional(form, key)
+	if value == nil {
+		return nil, nil
+	}
+
+	n, err := strconv.ParseInt(*value, 10, 64)
+	if err != nil {
+		return nil, awserr.New(ErrCodeInvalidParameterValue, fmt.Sprintf("Value %s for parameter %s is invalid.", *value, key), nil)
+	}
+
+	return aws.Int64(n), nil
+}
+
+// list returns the values of a flattened list parameter (prefix.1, prefix.2, ...)
+func list(form url.Values, prefix string) []*string {
+	var result []*string
+
+	for i := 1; ; i++ {
+		value := optional(form, fmt.Sprintf("%s.%d", prefix, i))
+		if value == nil {
+			return result
+		}
+
+		result = append(result, value)
+	}
+}
+
+// entries returns the prefixes of the entries of a flattened list of structures (prefix.1., prefix.2., ...)
+func entries(form url.Values, prefix string) []string {
+	var result []string
+
+	for i := 1; ; i++ {
+		entry := fmt.Sprintf("%s.%d.", prefix, i)
+		if optional(form, entry+"Id") == nil {
+			return result
+		}
+
+		result = append(result, entry)
+	}
+}
+
+// attributeMap returns the values of a flattened map parameter (prefix.N.Name, prefix.N.Value)
+func attributeMap(form url.Values, prefix string) map[string]*string {
+	var result map[string]*string
+
+	for i := 1; ; i++ {
+		name := optional(form, fmt.Sprintf("%s.%d.Name", prefix, i))
+		if name == nil {
+			return result
+		}
+
+		if result == nil {
+			result = make(map[string]*string)
+		}
+
+		result[*name] = optional(form, fmt.Sprintf("%s.%d.Value", prefix, i))
+	}
+}
+
+// messageAttributes returns the values of a flattened message attribute map parameter
+func messageAttributes(form url.Values, prefix string) (map[string]*sqs.MessageAttributeValue, error) {
+	var result map[string]*sqs.MessageAttributeValue
+
+	for i := 1; ; i++ {
+		entry := fmt.Sprintf("%s.%d.", prefix, i)
+		name := optional(form, entry+"Name")
+		if name == nil {
+			return result, nil
+		}
+
+		value := &sqs.MessageAttributeValue{
+			DataType:    optional(form, entry+"Value.DataType"),
+			StringValue: optional(form, entry+"Value.StringValue"),
+		}
+
+		if binary := optional(form, entry+"Value.BinaryValue"); binary != nil {
+			data, err := base64.StdEncoding.DecodeString(*binary)
+			if err != nil {
+				return nil, awserr.New(ErrCodeInvalidParameterValue, fmt.Sprintf("Invalid binary value for message attribute %s.", *name), nil)
+			}
+
+			value.BinaryValue = data
+		}
+
+		if result == nil {
+			result = make(map[string]*sqs.MessageAttributeValue)
+		}
+
+		result[*name] = value
+	}
+}
+
+// serveJSON serves a JSON protocol request. Inputs and outputs are the SDK types,
+// whose field names match the JSON protocol's member names.
+func (s *SQS) serveJSON(w http.ResponseWriter, r *http.Request, action string) {
+	ctx := r.Context()
+	decode := func(input interface{}) error {
+		if err := json.NewDecoder(r.Body).Decode(input); err != nil {
+			return awserr.New("SerializationException", err.Error(), nil)
+		}
+
+		return nil
+	}
+
+	var (
+		output interface{}
+		err    error
+	)
+
+	switch action {
+	case "CreateQueue":
+		input := &sqs.CreateQueueInput{}
+		if err = decode(input); err == nil {
+			output, err = s.CreateQueueWithContext(ctx, input)
+		}
+	case "GetQueueUrl":
+		input := &sqs.GetQueueUrlInput{}
+		if err = decode(input); err == nil {
+			output, err = s.GetQueueUrlWithContext(ctx, input)
+		}
+	case "DeleteQueue":
+		input := &sqs.DeleteQueueInput{}
+		if err = decode(input); err == nil {
+			output, err = s.DeleteQueueWithContext(ctx, input)
+		}
+	case "PurgeQueue":
+		input := &sqs.PurgeQueueInput{}
+		if err = decode(input); err == nil {
+			output, err = s.PurgeQueueWithContext(ctx, input)
+		}
+	case "ListQueues":
+		input := &sqs.ListQueuesInput{}
+		if err = decode(input); err == nil {
+			output, err = s.ListQueuesWithContext(ctx, input)
+		}
+	case "GetQueueAttributes":
+		input := &sqs.GetQueueAttributesInput{}
+		if err = decode(input); err == nil {
+			output, err = s.GetQueueAttributesWithContext(ctx, input)
+		}
+	case "SetQueueAttributes":
+		input := &sqs.SetQueueAttributesInput{}
+		if err = decode(input); err == nil {
+			output, err = s.SetQueueAttributesWithContext(ctx, input)
+		}
+	case "SendMessage":
+		input := &sqs.SendMessageInput{}
+		if err = decode(input); err == nil {
+			output, err = s.SendMessageWithContext(ctx, input)
+		}
+	case "SendMessageBatch":
+		input := &sqs.SendMessageBatchInput{}
+		if err = decode(input); err == nil {
+			output, err = s.SendMessageBatchWithContext(ctx, input)
+		}
+	case "ReceiveMessage":
+		input := &sqs.ReceiveMessageInput{}
+		if err = decode(input); err == nil {
+			output, err = s.ReceiveMessageWithContext(ctx, input)
+		}
+	case "DeleteMessage":
+		input := &sqs.DeleteMessageInput{}
+		if err = decode(input); err == nil {
+			output, err = s.DeleteMessageWithContext(ctx, input)
+		}
+	case "DeleteMessageBatch":
+		input := &sqs.DeleteMessageBatchInput{}
+		if err = decode(input); err == nil {
+			output, err = s.DeleteMessageBatchWithContext(ctx, input)
+		}
+	case "ChangeMessageVisibility":
+		input := &sqs.ChangeMessageVisibilityInput{}
+		if err = decode(input); err == nil {
+			output, err = s.ChangeMessageVisibilityWithContext(ctx, input)
+		}
+	case "ChangeMessageVisibilityBatch":
+		input := &sqs.ChangeMessageVisibilityBatchInput{}
+		if err = decode(input); err == nil {
+			output, err = s.ChangeMessageVisibilityBatchWithContext(ctx, input)
+		}
+	default:
+		err = awserr.New("InvalidAction", fmt.Sprintf("The action %s is not valid for this endpoint.", action), nil)
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+
+	if err != nil {
+		code, message := errorCode(err)
+		w.Header().Set("X-Amzn-Query-Error", code+";Sender")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"__type": code, "message": message})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(output)
+}
@@ -0,0 +1,230 @@
+package fake
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+// queryResponse holds the fields of query protocol responses checked by tests
+type queryResponse struct {
+	XMLName xml.Name
+	Result  struct {
+		QueueUrl   string
+		MessageId  string
+		Attributes []attribute `xml:"Attribute"`
+		Messages   []struct {
+			MessageId         string
+			ReceiptHandle     string
+			MD5OfBody         string
+			Body              string
+			Attributes        []attribute        `xml:"Attribute"`
+			MessageAttributes []messageAttribute `xml:"MessageAttribute"`
+		} `xml:"Message"`
+		Successful []idEntry                   `xml:"DeleteMessageBatchResultEntry"`
+		Failed     []sqs.BatchResultErrorEntry `xml:"BatchResultErrorEntry"`
+	} `xml:",any"`
+	Error struct {
+		Code string
+	}
+}
+
+func query(t *testing.T, server *httptest.Server, values url.Values) (int, queryResponse) {
+	res, err := http.PostForm(server.URL, values)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	var body queryResponse
+	assert.NoError(t, xml.NewDecoder(res.Body).Decode(&body))
+
+	return res.StatusCode, body
+}
+
+func TestServeQuery(t *testing.T) {
+	s, _ := setup(t)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	status, res := query(t, server, url.Values{
+		"Action":            {"CreateQueue"},
+		"QueueName":         {"queue"},
+		"Attribute.1.Name":  {"VisibilityTimeout"},
+		"Attribute.1.Value": {"60"},
+	})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "CreateQueueResponse", res.XMLName.Local)
+	assert.Equal(t, namespace, res.XMLName.Space)
+	queueURL := res.Result.QueueUrl
+	assert.Equal(t, "https://sqs.us-east-1.amazonaws.com/000000000000/queue", queueURL)
+
+	_, res = query(t, server, url.Values{
+		"Action":                               {"SendMessage"},
+		"QueueUrl":                             {queueURL},
+		"MessageBody":                          {"hello"},
+		"MessageAttribute.1.Name":              {"color"},
+		"MessageAttribute.1.Value.DataType":    {"String"},
+		"MessageAttribute.1.Value.StringValue": {"red"},
+	})
+	assert.NotEmpty(t, res.Result.MessageId)
+
+	_, res = query(t, server, url.Values{
+		"Action":                 {"ReceiveMessage"},
+		"QueueUrl":               {queueURL},
+		"AttributeName.1":        {"ApproximateReceiveCount"},
+		"MessageAttributeName.1": {"All"},
+	})
+	if assert.Len(t, res.Result.Messages, 1) {
+		message := res.Result.Messages[0]
+		assert.Equal(t, "hello", message.Body)
+		assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", message.MD5OfBody)
+		assert.Equal(t, []attribute{{Name: "ApproximateReceiveCount", Value: "1"}}, message.Attributes)
+		assert.Equal(t, "color", message.MessageAttributes[0].Name)
+		assert.Equal(t, "red", aws.StringValue(message.MessageAttributes[0].Value.StringValue))
+
+		_, res = query(t, server, url.Values{
+			"Action":                              {"DeleteMessageBatch"},
+			"QueueUrl":                            {queueURL},
+			"DeleteMessageBatchRequestEntry.1.Id": {"0"},
+			"DeleteMessageBatchRequestEntry.1.ReceiptHandle": {message.ReceiptHandle},
+			"DeleteMessageBatchRequestEntry.2.Id":            {"1"},
+			"DeleteMessageBatchRequestEntry.2.ReceiptHandle": {"invalid"},
+		})
+		assert.Equal(t, []idEntry{{Id: aws.String("0")}}, res.Result.Successful)
+		if assert.Len(t, res.Result.Failed, 1) {
+			assert.Equal(t, "1", aws.StringValue(res.Result.Failed[0].Id))
+			assert.Equal(t, sqs.ErrCodeReceiptHandleIsInvalid, aws.StringValue(res.Result.Failed[0].Code))
+		}
+	}
+
+	_, res = query(t, server, url.Values{
+		"Action":          {"GetQueueAttributes"},
+		"QueueUrl":        {queueURL},
+		"AttributeName.1": {"VisibilityTimeout"},
+	})
+	assert.Equal(t, []attribute{{Name: "VisibilityTimeout", Value: "60"}}, res.Result.Attributes)
+
+	status, res = query(t, server, url.Values{
+		"Action":    {"GetQueueUrl"},
+		"QueueName": {"missing"},
+	})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "ErrorResponse", res.XMLName.Local)
+	assert.Equal(t, sqs.ErrCodeQueueDoesNotExist, res.Error.Code)
+
+	_, res = query(t, server, url.Values{"Action": {"TagQueue"}})
+	assert.Equal(t, "InvalidAction", res.Error.Code)
+}
+
+func TestServeJSON(t *testing.T) {
+	s, _ := setup(t)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	post := func(action, body string) (*http.Response, map[string]interface{}) {
+		req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+		req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		var output map[string]interface{}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&output))
+		return res, output
+	}
+
+	_, output := post("CreateQueue", `{"QueueName": "queue"}`)
+	queueURL := output["QueueUrl"].(string)
+
+	_, output = post("SendMessage", `{"QueueUrl": "`+queueURL+`", "MessageBody": "hello"}`)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", output["MD5OfMessageBody"])
+
+	_, output = post("ReceiveMessage", `{"QueueUrl": "`+queueURL+`"}`)
+	messages := output["Messages"].([]interface{})
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "hello", messages[0].(map[string]interface{})["Body"])
+	}
+
+	res, output := post("GetQueueUrl", `{"QueueName": "missing"}`)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Equal(t, sqs.ErrCodeQueueDoesNotExist, output["__type"])
+	assert.Equal(t, sqs.ErrCodeQueueDoesNotExist+";Sender", res.Header.Get("X-Amzn-Query-Error"))
+}
+
+func TestServeReset(t *testing.T) {
+	s, _ := setup(t)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	createQueue(t, s, "queue", nil)
+
+	res, err := http.Post(server.URL+ResetPath, "", nil)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	output, err := s.ListQueues(&sqs.ListQueuesInput{})
+	assert.NoError(t, err)
+	assert.Empty(t, output.QueueUrls)
+}
+
+func TestServeSDK(t *testing.T) {
+	s, _ := setup(t)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	client := sqs.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	})))
+
+	_, err := client.GetQueueUrl(&sqs.GetQueueUrlInput{QueueName: aws.String("queue")})
+	assert.Equal(t, sqs.ErrCodeQueueDoesNotExist, code(err))
+
+	queue, err := client.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String("queue")})
+	assert.NoError(t, err)
+
+	// the SDK validates the MD5 digests of the body and attributes
+	_, err = client.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:    queue.QueueUrl,
+		MessageBody: aws.String("hello"),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"color": {DataType: aws.String("String"), StringValue: aws.String("blue")},
+		},
+	})
+	assert.NoError(t, err)
+
+	received, err := client.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:              queue.QueueUrl,
+		MessageAttributeNames: aws.StringSlice([]string{"All"}),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, received.Messages, 1)
+	assert.Equal(t, "hello", aws.StringValue(received.Messages[0].Body))
+	assert.Equal(t, "blue", aws.StringValue(received.Messages[0].MessageAttributes["color"].StringValue))
+
+	output, err := client.DeleteMessageBatch(&sqs.DeleteMessageBatchInput{
+		QueueUrl: queue.QueueUrl,
+		Entries: []*sqs.DeleteMessageBatchRequestEntry{
+			{Id: aws.String("0"), ReceiptHandle: received.Messages[0].ReceiptHandle},
+			{Id: aws.String("1"), ReceiptHandle: aws.String("invalid")},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "0", aws.StringValue(output.Successful[0].Id))
+	assert.Equal(t, "1", aws.StringValue(output.Failed[0].Id))
+	assert.Equal(t, sqs.ErrCodeReceiptHandleIsInvalid, aws.StringValue(output.Failed[0].Code))
+}
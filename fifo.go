@@ -0,0 +1,223 @@
+package sqsch
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Message system attributes of messages received from FIFO queues
+const (
+	MessageGroupId = "MessageGroupId"
+	SequenceNumber = "SequenceNumber"
+)
+
+// ReceiveRequestAttemptTTL is how long SQS deduplicates ReceiveMessage requests with the same attempt id
+// https://docs.aws.amazon.com/AWSSimpleQueueService/latest/APIReference/API_ReceiveMessage.html
+const ReceiveRequestAttemptTTL = 5 * time.Minute
+
+// attempts generates ReceiveRequestAttemptId values, reusing the ids of failed requests
+// so that retries return the same messages instead of locking their message groups.
+// Failed attempts are only retried against the queue they were made to.
+type attempts struct {
+	mutex  sync.Mutex
+	failed map[string][]attempt
+}
+
+type attempt struct {
+	queue   string
+	id      string
+	created time.Time
+}
+
+func newAttempts() *attempts {
+	return &attempts{failed: make(map[string][]attempt)}
+}
+
+// next returns the id of a failed attempt to queue that can still be retried, or a new id
+func (a *attempts) next(queue string, now time.Time) attempt {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for failed := a.failed[queue]; len(failed) > 0; failed = a.failed[queue] {
+		retry := failed[0]
+		a.failed[queue] = failed[1:]
+
+		if now.Sub(retry.created) < ReceiveRequestAttemptTTL {
+			return retry
+		}
+	}
+
+	delete(a.failed, queue)
+	return attempt{queue: queue, id: newAttemptID(), created: now}
+}
+
+// retry records a failed attempt so its id is reused by the next request to its queue
+func (a *attempts) retry(failed attempt) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.failed[failed.queue] = append(a.failed[failed.queue], failed)
+}
+
+func newAttemptID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// MessageGroup returns the MessageGroupId system attribute of a message received from a
+// FIFO queue. It returns an empty string if the attribute was not received.
+func MessageGroup(message *sqs.Message) string {
+	return aws.StringValue(message.Attributes[MessageGroupId])
+}
+
+// groups serializes delivery of messages that belong to the same message group.
+// The first message of each group is in flight, and the rest wait until it is
+// deleted, at which point the next one becomes ready. If it is released instead,
+// the rest are released with it. Groups are scoped to the queue of their messages.
+type groups struct {
+	mutex   sync.Mutex
+	origins *origins
+	groups  map[groupKey][]*sqs.Message
+	ready   []*sqs.Message
+	signal  chan struct{}
+}
+
+// groupKey identifies a message group within a queue. The queue is empty when receiving
+// from a single queue.
+type groupKey struct {
+	queue string
+	group string
+}
+
+func newGroups(origins *origins) *groups {
+	return &groups{
+		origins: origins,
+		groups:  make(map[groupKey][]*sqs.Message),
+		signal:  make(chan struct{}, 1),
+	}
+}
+
+// key returns the group of a message. It returns false if the message has no group.
+func (g *groups) key(message *sqs.Message) (groupKey, bool) {
+	group := MessageGroup(message)
+	if group == "" {
+		return groupKey{}, false
+	}
+
+	return groupKey{queue: aws.StringValue(g.origins.get(message)), group: group}, true
+}
+
+// acquire returns true if a message can be delivered now. Otherwise it is queued
+// behind the in-flight message of its group.
+func (g *groups) acquire(message *sqs.Message) bool {
+	key, ok := g.key(message)
+	if !ok {
+		return true
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	queue := g.groups[key]
+	g.groups[key] = append(queue, message)
+
+	return len(queue) == 0
+}
+
+// done completes the in-flight message of a group, making the next message in the group ready
+func (g *groups) done(message *sqs.Message) {
+	key, ok := g.key(message)
+	if !ok {
+		return
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	queue := g.groups[key]
+	if len(queue) == 0 || aws.StringValue(queue[0].ReceiptHandle) != aws.StringValue(message.ReceiptHandle) {
+		return
+	}
+
+	if len(queue) == 1 {
+		delete(g.groups, key)
+		return
+	}
+
+	g.groups[key] = queue[1:]
+	g.ready = append(g.ready, queue[1])
+
+	select {
+	case g.signal <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the next message that is ready to be delivered, or nil
+func (g *groups) next() *sqs.Message {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if len(g.ready) == 0 {
+		return nil
+	}
+
+	message := g.ready[0]
+	g.ready = g.ready[1:]
+
+	return message
+}
+
+// release removes a message from its group and returns the messages queued behind it,
+// which must be released too so that they are not delivered before it
+func (g *groups) release(message *sqs.Message) []*sqs.Message {
+	key, ok := g.key(message)
+	if !ok {
+		return nil
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	queue := g.groups[key]
+	for i, m := range queue {
+		if aws.StringValue(m.ReceiptHandle) != aws.StringValue(message.ReceiptHandle) {
+			continue
+		}
+
+		if i == 0 {
+			delete(g.groups, key)
+		} else {
+			g.groups[key] = queue[:i]
+		}
+
+		return append([]*sqs.Message{}, queue[i+1:]...)
+	}
+
+	return nil
+}
+
+// drain removes and returns the messages that have been received but not delivered
+func (g *groups) drain() []*sqs.Message {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	result := g.ready
+	g.ready = nil
+
+	for key, queue := range g.groups {
+		result = append(result, queue[1:]...)
+		g.groups[key] = queue[:1]
+	}
+
+	return result
+}
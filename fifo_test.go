@@ -0,0 +1,190 @@
+package sqsch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFIFOAttemptId(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	inputs := make(chan *sqs.ReceiveMessageInput, 3)
+
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+			inputs <- input
+			return nil, errors.New("connection reset")
+		})
+
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+			inputs <- input
+			return &sqs.ReceiveMessageOutput{}, nil
+		})
+
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+			inputs <- input
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}).
+		AnyTimes()
+
+	mustStart(t, ctx, Options{
+		SQS: sqsapi,
+		Receive: ReceiveOptions{
+			RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: aws.String("http://foo.bar/queue.fifo")},
+			FIFO:                true,
+		},
+	})
+
+	failed, retried, next := <-inputs, <-inputs, <-inputs
+
+	assert.NotEmpty(t, aws.StringValue(failed.ReceiveRequestAttemptId))
+	assert.Equal(t, failed.ReceiveRequestAttemptId, retried.ReceiveRequestAttemptId)
+	assert.NotEqual(t, retried.ReceiveRequestAttemptId, next.ReceiveRequestAttemptId)
+	assert.Equal(t, aws.StringSlice([]string{MessageGroupId, SequenceNumber}), failed.AttributeNames)
+}
+
+func TestFIFOGroups(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	message := func(group string, handle string) *sqs.Message {
+		return &sqs.Message{
+			ReceiptHandle: aws.String(handle),
+			Attributes:    aws.StringMap(map[string]string{MessageGroupId: group}),
+		}
+	}
+
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), gomock.Any()).
+		Return(&sqs.ReceiveMessageOutput{
+			Messages: []*sqs.Message{message("a", "a1"), message("a", "a2"), message("b", "b1"), message("a", "a3")},
+		}, nil)
+
+	blockReceives(sqsapi)
+
+	sqsapi.
+		EXPECT().
+		DeleteMessageBatchWithContext(gomock.Any(), gomock.Any()).
+		Return(&sqs.DeleteMessageBatchOutput{}, nil).
+		AnyTimes()
+
+	sqsapi.
+		EXPECT().
+		ChangeMessageVisibilityBatchWithContext(gomock.Any(), gomock.Any()).
+		Return(&sqs.ChangeMessageVisibilityBatchOutput{}, nil).
+		AnyTimes()
+
+	dispatch := mustNew(t, Options{
+		SQS: sqsapi,
+		Receive: ReceiveOptions{
+			RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: aws.String("http://foo.bar/queue.fifo")},
+			BufferSize:          10,
+			FIFO:                true,
+		},
+	})
+	dispatch.Start(ctx)
+
+	next := func() string {
+		select {
+		case message := <-dispatch.Receives():
+			return aws.StringValue(message.ReceiptHandle)
+		case <-time.After(50 * time.Millisecond):
+			return ""
+		}
+	}
+
+	assert.Equal(t, "a1", next())
+	assert.Equal(t, "b1", next())
+	assert.Equal(t, "", next())
+
+	dispatch.Deletes() <- message("a", "a1")
+	assert.Equal(t, "a2", next())
+	assert.Equal(t, "", next())
+
+	dispatch.Releases() <- &Release{Message: message("a", "a2")}
+	assert.Equal(t, "", next(), "a3 is released with a2")
+}
+
+func TestFIFOGroupsRelease(t *testing.T) {
+	groups := newGroups(newOrigins())
+	message := func(handle string) *sqs.Message {
+		return &sqs.Message{
+			ReceiptHandle: aws.String(handle),
+			Attributes:    aws.StringMap(map[string]string{MessageGroupId: "a"}),
+		}
+	}
+
+	a1, a2, a3 := message("a1"), message("a2"), message("a3")
+	assert.True(t, groups.acquire(a1))
+	assert.False(t, groups.acquire(a2))
+	assert.False(t, groups.acquire(a3))
+
+	assert.Equal(t, []*sqs.Message{a3}, groups.release(a2))
+	assert.Equal(t, []*sqs.Message{}, groups.release(a1))
+	assert.True(t, groups.acquire(message("a4")))
+}
+
+func TestFIFOGroupsFailure(t *testing.T) {
+	dispatch := newUnvalidated(Options{Receive: ReceiveOptions{FIFO: true}})
+	message := func(handle string) *sqs.Message {
+		return &sqs.Message{
+			ReceiptHandle: aws.String(handle),
+			Attributes:    aws.StringMap(map[string]string{MessageGroupId: "a"}),
+		}
+	}
+
+	a1, a2 := message("a1"), message("a2")
+	dispatch.forward(context.TODO(), &received{message: a1, err: errors.New("claim check error")})
+	dispatch.forward(context.TODO(), &received{message: a2})
+
+	assert.Equal(t, &Release{Message: a1}, <-dispatch.releases)
+	assert.Empty(t, dispatch.receives, "a2 waits behind a1")
+	assert.Equal(t, []*sqs.Message{a2}, dispatch.groups.release(a1))
+}
+
+func TestFIFOGroupsQueues(t *testing.T) {
+	origins := newOrigins()
+	groups := newGroups(origins)
+
+	message := func(queue string) *sqs.Message {
+		message := &sqs.Message{
+			ReceiptHandle: aws.String(queue),
+			Attributes:    aws.StringMap(map[string]string{MessageGroupId: "a"}),
+		}
+		origins.add(message, aws.String(queue))
+		return message
+	}
+
+	assert.True(t, groups.acquire(message("http://foo.bar/a.fifo")))
+	assert.True(t, groups.acquire(message("http://foo.bar/b.fifo")))
+}
+
+func TestFIFOAttemptsQueues(t *testing.T) {
+	attempts := newAttempts()
+	now := time.Now()
+
+	failed := attempts.next("a", now)
+	attempts.retry(failed)
+
+	assert.NotEqual(t, failed.id, attempts.next("b", now).id)
+	assert.Equal(t, failed.id, attempts.next("a", now).id)
+	assert.NotEqual(t, failed.id, attempts.next("a", now).id)
+}
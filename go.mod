@@ -1,10 +1,18 @@
 module github.com/bendrucker/sqs-receive-channel
 
-go 1.12
+go 1.18
 
 require (
 	github.com/aws/aws-sdk-go v1.20.15
-	github.com/bendrucker/bach v0.0.0-20190705014630-3842edc7131b
-	github.com/golang/mock v1.3.1
-	github.com/stretchr/testify v1.3.0
+	github.com/golang/mock v1.4.4
+	github.com/stretchr/testify v1.8.2
+	go.opentelemetry.io/otel v1.14.0
+	go.opentelemetry.io/otel/trace v1.14.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/jmespath/go-jmespath v0.0.0-20180206201540-c2b33e8439af // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,334 @@
+package sqsch
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"github.com/bendrucker/sqs-receive-channel/pkg/batch"
+)
+
+// HeartbeatOptions configures automatic extension of the visibility timeout of
+// messages that have been received but not yet deleted. Heartbeats are disabled
+// unless Interval is set.
+type HeartbeatOptions struct {
+	// Interval is how often in-flight messages are extended
+	Interval time.Duration
+	// VisibilityTimeout is the visibility timeout set on each extension (default: 3 * Interval,
+	// or the queue's visibility timeout with Options.AutoConfigure)
+	VisibilityTimeout time.Duration
+	// MaxLease is the maximum total time a message is kept invisible after it is received
+	// (default: MaxVisibilityTimeout)
+	MaxLease time.Duration
+}
+
+// Defaults sets default values
+func (ho *HeartbeatOptions) Defaults() {
+	if !ho.Enabled() {
+		return
+	}
+
+	if ho.VisibilityTimeout == 0 {
+		ho.VisibilityTimeout = 3 * ho.Interval
+	}
+
+	if ho.MaxLease == 0 || ho.MaxLease > MaxVisibilityTimeout {
+		ho.MaxLease = MaxVisibilityTimeout
+	}
+}
+
+// Enabled returns whether heartbeats are enabled
+func (ho *HeartbeatOptions) Enabled() bool {
+	return ho.Interval > 0
+}
+
+// BatchChangeVisibilityError represents an error returned from SQS in response to a ChangeMessageVisibilityBatch request
+type BatchChangeVisibilityError struct {
+	Code          string
+	Message       string
+	ReceiptHandle string
+}
+
+func (err *BatchChangeVisibilityError) Error() string {
+	return fmt.Sprintf("SQS batch change visibility error: %s (%s)", err.Message, err.Code)
+}
+
+// visibilityChange is a request to set the visibility timeout of a received message
+type visibilityChange struct {
+	message *sqs.Message
+	timeout time.Duration
+	// release is set when the message is being returned to the queue
+	release bool
+}
+
+// Heartbeat runs a loop that extends the visibility timeout of every message that has
+// been received but not deleted, until Shutdown stops accepting input or the supplied
+// context is canceled.
+// Every Heartbeat.Interval, each tracked message is extended by Heartbeat.VisibilityTimeout.
+// Messages are no longer extended once they have been held for Heartbeat.MaxLease.
+// It does nothing unless heartbeats are enabled.
+func (d *Dispatch) Heartbeat(ctx context.Context) {
+	if !d.Options.Heartbeat.Enabled() {
+		return
+	}
+
+	d.changers.Add(1)
+
+	go func() {
+		defer d.changers.Done()
+
+		ticker := time.NewTicker(d.Options.Heartbeat.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-d.stopping:
+				return
+			case now := <-ticker.C:
+				d.extend(ctx, now)
+			}
+		}
+	}()
+}
+
+func (d *Dispatch) extend(ctx context.Context, now time.Time) {
+	for _, lease := range d.leases.due() {
+		remaining := d.Options.Heartbeat.MaxLease - now.Sub(lease.received)
+
+		if remaining < time.Second {
+			d.leases.remove(lease.message)
+			continue
+		}
+
+		timeout := d.Options.Heartbeat.VisibilityTimeout
+		if remaining < timeout {
+			timeout = remaining
+		}
+
+		select {
+		case d.changes <- &visibilityChange{message: lease.message, timeout: timeout}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ChangeVisibility processes visibility changes from heartbeats and releases until they
+// are closed by Shutdown or the supplied context is canceled.
+// It batches changes using the same interval and concurrency as Delete and calls the SQS
+// ChangeMessageVisibilityBatch API. If there are failures in the ChangeMessageVisibilityBatchOutput,
+// it sends one error per failure to the errors channel and stops tracking the failed message.
+func (d *Dispatch) ChangeVisibility(ctx context.Context) {
+	input := make(chan interface{})
+	go func() {
+		for change := range d.changes {
+			input <- change
+		}
+
+		close(input)
+	}()
+
+	batches := batch.New(input, MaxBatchSize, d.Options.Delete.Interval)
+
+	for i := 0; i < d.Options.Delete.Concurrency; i++ {
+		d.changing.Add(1)
+
+		go func() {
+			defer d.changing.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case changes, ok := <-batches:
+					if !ok {
+						return
+					}
+
+					d.changeVisibilityBatch(ctx, changes)
+				}
+			}
+		}()
+	}
+}
+
+func (d *Dispatch) changeVisibilityBatch(ctx context.Context, changes []interface{}) {
+	messages := make([]*sqs.Message, len(changes))
+	for i, change := range changes {
+		messages[i] = change.(*visibilityChange).message
+	}
+
+	defer func() {
+		for _, c := range changes {
+			change := c.(*visibilityChange)
+			d.leases.extended(change.message)
+
+			if change.release {
+				d.origins.remove(change.message)
+			}
+		}
+	}()
+
+	urls, indexes := d.byQueue(messages)
+	for _, url := range urls {
+		d.changeVisibilityQueueBatch(ctx, url, changes, indexes[aws.StringValue(url)])
+	}
+}
+
+func (d *Dispatch) changeVisibilityQueueBatch(ctx context.Context, url *string, changes []interface{}, indexes []int) {
+	entries := make([]*sqs.ChangeMessageVisibilityBatchRequestEntry, 0, len(indexes))
+
+	for _, i := range indexes {
+		change := changes[i].(*visibilityChange)
+
+		// the message may have been deleted or released since its heartbeat was scheduled,
+		// and extending it would hide it again or fail with an invalid receipt handle
+		if !change.release && !d.leases.held(change.message) {
+			continue
+		}
+
+		entries = append(entries, &sqs.ChangeMessageVisibilityBatchRequestEntry{
+			Id:                aws.String(strconv.Itoa(i)),
+			ReceiptHandle:     change.message.ReceiptHandle,
+			VisibilityTimeout: aws.Int64(int64(change.timeout / time.Second)),
+		})
+	}
+
+	if len(entries) == 0 {
+		return
+	}
+
+	start := time.Now()
+	output, err := d.Options.SQS.ChangeMessageVisibilityBatchWithContext(ctx, &sqs.ChangeMessageVisibilityBatchInput{
+		Entries:  entries,
+		QueueUrl: url,
+	})
+	d.observe("ChangeMessageVisibilityBatch", start, err)
+
+	if err != nil {
+		d.log(ctx, LogError, "change visibility batch failed", url, LogKeyCount, len(entries), LogKeyError, err)
+		d.error(ctx, err)
+		return
+	}
+
+	for _, failure := range output.Failed {
+		i, err := strconv.Atoi(aws.StringValue(failure.Id))
+		if err != nil || i < 0 || i >= len(changes) {
+			continue
+		}
+
+		message := changes[i].(*visibilityChange).message
+		d.leases.remove(message)
+		d.log(ctx, LogWarn, "change visibility failed", url,
+			LogKeyMessageID, aws.StringValue(message.MessageId),
+			LogKeyCode, aws.StringValue(failure.Code),
+			LogKeyError, aws.StringValue(failure.Message),
+		)
+		d.error(ctx, &BatchChangeVisibilityError{
+			Code:          aws.StringValue(failure.Code),
+			Message:       aws.StringValue(failure.Message),
+			ReceiptHandle: aws.StringValue(message.ReceiptHandle),
+		})
+	}
+}
+
+// track starts tracking a received message for heartbeats if they are enabled
+func (d *Dispatch) track(message *sqs.Message) {
+	if d.Options.Heartbeat.Enabled() {
+		d.leases.add(message, time.Now())
+	}
+}
+
+// leases tracks in-flight messages by receipt handle
+type leases struct {
+	mutex  sync.Mutex
+	leases map[string]lease
+}
+
+// lease is an in-flight message and the time it was received
+type lease struct {
+	message  *sqs.Message
+	received time.Time
+	// extending is set while a heartbeat for the message is pending
+	extending bool
+}
+
+func newLeases() *leases {
+	return &leases{leases: make(map[string]lease)}
+}
+
+func (l *leases) add(message *sqs.Message, received time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.leases[aws.StringValue(message.ReceiptHandle)] = lease{message: message, received: received}
+}
+
+func (l *leases) remove(message *sqs.Message) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.leases, aws.StringValue(message.ReceiptHandle))
+}
+
+// held returns whether the message is still tracked. It is not once it has been deleted or
+// released, or its lease has expired.
+func (l *leases) held(message *sqs.Message) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	_, ok := l.leases[aws.StringValue(message.ReceiptHandle)]
+	return ok
+}
+
+// due returns the tracked leases that do not have a pending heartbeat
+// and marks them as extending until extended is called
+func (l *leases) due() []lease {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	result := make([]lease, 0, len(l.leases))
+	for handle, lease := range l.leases {
+		if lease.extending {
+			continue
+		}
+
+		lease.extending = true
+		l.leases[handle] = lease
+		result = append(result, lease)
+	}
+
+	return result
+}
+
+// extended marks a heartbeat for the message as complete
+func (l *leases) extended(message *sqs.Message) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	handle := aws.StringValue(message.ReceiptHandle)
+	if lease, ok := l.leases[handle]; ok {
+		lease.extending = false
+		l.leases[handle] = lease
+	}
+}
+
+// list returns a snapshot of the tracked leases
+func (l *leases) list() []lease {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	result := make([]lease, 0, len(l.leases))
+	for _, lease := range l.leases {
+		result = append(result, lease)
+	}
+
+	return result
+}
@@ -0,0 +1,163 @@
+package sqsch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeat(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl: aws.String("http://foo.bar"),
+	}
+
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), gomock.Any()).
+		Return(&sqs.ReceiveMessageOutput{
+			Messages: []*sqs.Message{{
+				Body:          aws.String("hello world"),
+				ReceiptHandle: aws.String("handle"),
+			}},
+		}, nil)
+
+	blockReceives(sqsapi)
+
+	changes := make(chan *sqs.ChangeMessageVisibilityBatchInput, 1)
+	sqsapi.
+		EXPECT().
+		ChangeMessageVisibilityBatchWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, input *sqs.ChangeMessageVisibilityBatchInput) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+			select {
+			case changes <- input:
+			default:
+			}
+
+			return &sqs.ChangeMessageVisibilityBatchOutput{}, nil
+		}).
+		MinTimes(1)
+
+	receive, _, _ := mustStart(t, ctx, Options{
+		SQS:       sqsapi,
+		Receive:   ReceiveOptions{RecieveMessageInput: input},
+		Delete:    DeleteOptions{Interval: time.Millisecond},
+		Heartbeat: HeartbeatOptions{Interval: 50 * time.Millisecond, VisibilityTimeout: 30 * time.Second},
+	})
+
+	<-receive
+
+	assert.Equal(t, &sqs.ChangeMessageVisibilityBatchInput{
+		QueueUrl: aws.String("http://foo.bar"),
+		Entries: []*sqs.ChangeMessageVisibilityBatchRequestEntry{
+			{
+				Id:                aws.String("0"),
+				ReceiptHandle:     aws.String("handle"),
+				VisibilityTimeout: aws.Int64(30),
+			},
+		},
+	}, <-changes)
+
+	cancel()
+}
+
+func TestHeartbeatMaxLease(t *testing.T) {
+	dispatch := newUnvalidated(Options{
+		Heartbeat: HeartbeatOptions{
+			Interval:          time.Second,
+			VisibilityTimeout: time.Minute,
+			MaxLease:          time.Hour,
+		},
+	})
+
+	now := time.Now()
+	expired := &sqs.Message{ReceiptHandle: aws.String("expired")}
+	expiring := &sqs.Message{ReceiptHandle: aws.String("expiring")}
+
+	dispatch.leases.add(expired, now.Add(-time.Hour))
+	dispatch.leases.add(expiring, now.Add(-time.Hour+10*time.Second))
+
+	dispatch.extend(context.TODO(), now)
+
+	change := <-dispatch.changes
+	assert.Equal(t, expiring, change.message)
+	assert.Equal(t, 10*time.Second, change.timeout)
+	assert.Len(t, dispatch.leases.list(), 1)
+}
+
+func TestHeartbeatStopsAfterDelete(t *testing.T) {
+	dispatch := newUnvalidated(Options{
+		Delete:    DeleteOptions{Interval: time.Millisecond},
+		Heartbeat: HeartbeatOptions{Interval: time.Second},
+	})
+
+	message := &sqs.Message{ReceiptHandle: aws.String("handle")}
+	dispatch.track(message)
+
+	batches := dispatch.BatchDeletes(dispatch.deletes)
+	dispatch.deletes <- message
+	<-batches
+
+	assert.Empty(t, dispatch.leases.list())
+}
+
+func TestHeartbeatPending(t *testing.T) {
+	dispatch := newUnvalidated(Options{
+		Heartbeat: HeartbeatOptions{Interval: time.Second},
+	})
+
+	message := &sqs.Message{ReceiptHandle: aws.String("handle")}
+	dispatch.track(message)
+
+	assert.Len(t, dispatch.leases.due(), 1)
+	assert.Len(t, dispatch.leases.due(), 0)
+
+	dispatch.leases.extended(message)
+	assert.Len(t, dispatch.leases.due(), 1)
+}
+
+func TestHeartbeatAfterRelease(t *testing.T) {
+	_, sqsapi, finish := setup(t)
+	defer finish()
+
+	dispatch := newUnvalidated(Options{
+		SQS:       sqsapi,
+		Receive:   ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: aws.String("http://foo.bar")}},
+		Heartbeat: HeartbeatOptions{Interval: time.Second},
+	})
+
+	released := &sqs.Message{ReceiptHandle: aws.String("released")}
+	held := &sqs.Message{ReceiptHandle: aws.String("held")}
+	dispatch.track(released)
+	dispatch.track(held)
+	assert.Len(t, dispatch.leases.due(), 2)
+
+	// released after its heartbeat was scheduled
+	dispatch.leases.remove(released)
+
+	sqsapi.
+		EXPECT().
+		ChangeMessageVisibilityBatchWithContext(gomock.Any(), &sqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String("http://foo.bar"),
+			Entries: []*sqs.ChangeMessageVisibilityBatchRequestEntry{
+				{Id: aws.String("1"), ReceiptHandle: aws.String("released"), VisibilityTimeout: aws.Int64(0)},
+				{Id: aws.String("2"), ReceiptHandle: aws.String("held"), VisibilityTimeout: aws.Int64(30)},
+			},
+		}).
+		Return(&sqs.ChangeMessageVisibilityBatchOutput{}, nil)
+
+	dispatch.changeVisibilityBatch(context.Background(), []interface{}{
+		&visibilityChange{message: released, timeout: 30 * time.Second},
+		&visibilityChange{message: released, release: true},
+		&visibilityChange{message: held, timeout: 30 * time.Second},
+	})
+}
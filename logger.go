@@ -0,0 +1,164 @@
+package sqsch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+
+	"github.com/bendrucker/sqs-receive-channel/pkg/receive"
+)
+
+// LogLevel is the severity of a log record. Its values match those of log/slog.
+type LogLevel int
+
+const (
+	// LogDebug records routine events, such as each receive and delete batch
+	LogDebug LogLevel = -4
+	// LogInfo records changes in state, such as starting and stopping (the default level)
+	LogInfo LogLevel = 0
+	// LogWarn records failures that are retried or reported as errors
+	LogWarn LogLevel = 4
+	// LogError records failures of entire requests
+	LogError LogLevel = 8
+)
+
+func (l LogLevel) String() string {
+	switch {
+	case l < LogInfo:
+		return "DEBUG"
+	case l < LogWarn:
+		return "INFO"
+	case l < LogError:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+// Logger receives structured log records from a Dispatch. Attributes are passed as
+// alternating keys and values. Log may be called concurrently from multiple goroutines.
+type Logger interface {
+	Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{})
+}
+
+// LoggerFunc is an adapter that allows an ordinary function to be used as a Logger
+type LoggerFunc func(ctx context.Context, level LogLevel, msg string, keyvals ...interface{})
+
+// Log calls f(ctx, level, msg, keyvals...)
+func (f LoggerFunc) Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	f(ctx, level, msg, keyvals...)
+}
+
+// NopLogger is a Logger that discards everything. It is the default.
+type NopLogger struct{}
+
+// Log does nothing
+func (NopLogger) Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {}
+
+// StdLogger returns a Logger that writes records to a standard library logger as
+// "LEVEL msg key=value ..."
+func StdLogger(logger *log.Logger) Logger {
+	return LoggerFunc(func(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s %s", level, msg)
+
+		for i := 0; i < len(keyvals); i += 2 {
+			var value interface{} = "MISSING"
+			if i+1 < len(keyvals) {
+				value = keyvals[i+1]
+			}
+
+			fmt.Fprintf(&b, " %v=%v", keyvals[i], value)
+		}
+
+		logger.Print(b.String())
+	})
+}
+
+// Keys of the attributes of log records
+const (
+	LogKeyQueueURL  = "queue_url"
+	LogKeyMessageID = "message_id"
+	LogKeyCount     = "count"
+	LogKeyReason    = "reason"
+	LogKeyCode      = "code"
+	LogKeyError     = "error"
+	LogKeyState     = "state"
+	LogKeyPrevious  = "previous"
+	LogKeyField     = "field"
+)
+
+// log sends a record about the queue at url to the Logger if level is at least Options.LogLevel
+func (d *Dispatch) log(ctx context.Context, level LogLevel, msg string, url *string, keyvals ...interface{}) {
+	if level < d.Options.LogLevel {
+		return
+	}
+
+	d.Options.Logger.Log(ctx, level, msg, append([]interface{}{LogKeyQueueURL, aws.StringValue(url)}, keyvals...)...)
+}
+
+// loopState is the state of the receive loop, which is logged when it changes
+type loopState struct {
+	paused  int32
+	failing int32
+}
+
+// transition sets a flag and returns whether it changed
+func transition(flag *int32, value bool) bool {
+	var n int32
+	if value {
+		n = 1
+	}
+
+	return atomic.SwapInt32(flag, n) != n
+}
+
+// logCapacity logs when receiving pauses because there is no capacity and when it resumes
+func (d *Dispatch) logCapacity(ctx context.Context, capacity int) {
+	if !transition(&d.loop.paused, capacity == 0) {
+		return
+	}
+
+	if capacity == 0 {
+		d.log(ctx, LogDebug, "receive paused: no capacity", d.QueueURL())
+	} else {
+		d.log(ctx, LogDebug, "receive resumed", d.QueueURL(), LogKeyCount, capacity)
+	}
+}
+
+// logReceive logs the result of a ReceiveMessage request and changes between failing and succeeding
+func (d *Dispatch) logReceive(ctx context.Context, url *string, count int, err error) {
+	if err != nil {
+		if transition(&d.loop.failing, true) {
+			d.log(ctx, LogWarn, "receive failing", url, LogKeyError, err)
+		} else {
+			d.log(ctx, LogDebug, "receive failed", url, LogKeyError, err)
+		}
+
+		return
+	}
+
+	if transition(&d.loop.failing, false) {
+		d.log(ctx, LogInfo, "receive recovered", url)
+	}
+
+	if count == 0 {
+		d.log(ctx, LogDebug, "empty receive", url)
+	} else {
+		d.log(ctx, LogDebug, "received messages", url, LogKeyCount, count)
+	}
+}
+
+// logBreaker logs changes of the state of the receive circuit breaker
+func (d *Dispatch) logBreaker(ctx context.Context, from, to receive.State) {
+	level := LogInfo
+	if to == receive.StateOpen {
+		level = LogWarn
+	}
+
+	d.log(ctx, level, "receive circuit "+to.String(), d.QueueURL(), LogKeyState, to.String(), LogKeyPrevious, from.String())
+}
@@ -0,0 +1,15 @@
+//go:build go1.21
+
+package sqsch
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogLogger returns a Logger that writes records to a log/slog logger
+func SlogLogger(logger *slog.Logger) Logger {
+	return LoggerFunc(func(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+		logger.Log(ctx, slog.Level(level), msg, keyvals...)
+	})
+}
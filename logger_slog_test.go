@@ -0,0 +1,28 @@
+//go:build go1.21
+
+package sqsch
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := SlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+
+			return a
+		},
+	})))
+
+	logger.Log(context.Background(), LogWarn, "delete failed", LogKeyQueueURL, "https://queue", LogKeyCode, "ReceiptHandleIsInvalid")
+	assert.Equal(t, "level=WARN msg=\"delete failed\" queue_url=https://queue code=ReceiptHandleIsInvalid\n", buf.String())
+}
@@ -0,0 +1,114 @@
+package sqsch
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/bendrucker/sqs-receive-channel/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+// record is a log record captured by a test
+type record struct {
+	level   LogLevel
+	msg     string
+	keyvals map[interface{}]interface{}
+}
+
+// records is a Logger that captures log records
+type records struct {
+	mutex   sync.Mutex
+	records []record
+}
+
+func (r *records) Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	rec := record{level: level, msg: msg, keyvals: make(map[interface{}]interface{})}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		rec.keyvals[keyvals[i]] = keyvals[i+1]
+	}
+
+	r.records = append(r.records, rec)
+}
+
+func (r *records) find(msg string) []record {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var found []record
+	for _, rec := range r.records {
+		if rec.msg == msg {
+			found = append(found, rec)
+		}
+	}
+
+	return found
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := StdLogger(log.New(&buf, "", 0))
+
+	logger.Log(context.Background(), LogWarn, "delete failed", LogKeyCode, "ReceiptHandleIsInvalid", "dangling")
+	assert.Equal(t, "WARN delete failed code=ReceiptHandleIsInvalid dangling=MISSING\n", buf.String())
+}
+
+func TestLogLevel(t *testing.T) {
+	logger := &records{}
+	dispatch := newUnvalidated(Options{Logger: logger, LogLevel: LogWarn})
+
+	dispatch.log(context.Background(), LogInfo, "info", nil)
+	dispatch.log(context.Background(), LogError, "error", aws.String("https://queue"))
+
+	assert.Empty(t, logger.find("info"))
+	if records := logger.find("error"); assert.Len(t, records, 1) {
+		assert.Equal(t, "https://queue", records[0].keyvals[LogKeyQueueURL])
+	}
+}
+
+func TestLogger(t *testing.T) {
+	sqsapi := fake.New(fake.Options{})
+	queue, err := sqsapi.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String("queue")})
+	assert.NoError(t, err)
+
+	_, err = sqsapi.SendMessage(&sqs.SendMessageInput{QueueUrl: queue.QueueUrl, MessageBody: aws.String("hello")})
+	assert.NoError(t, err)
+
+	logger := &records{}
+	dispatch := mustNew(t, Options{
+		SQS:      sqsapi,
+		Receive:  ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: queue.QueueUrl}},
+		Delete:   DeleteOptions{Interval: time.Hour},
+		Errors:   ErrorOptions{Handler: func(error) {}},
+		Logger:   logger,
+		LogLevel: LogDebug,
+	})
+	dispatch.Start(context.Background())
+
+	dispatch.Releases() <- &Release{Message: <-dispatch.Receives()}
+	dispatch.Deletes() <- &sqs.Message{MessageId: aws.String("id"), ReceiptHandle: aws.String("invalid")}
+	assert.NoError(t, dispatch.Shutdown(context.Background()))
+
+	assert.Len(t, logger.find("receive started"), 1)
+	assert.Len(t, logger.find("receive stopped"), 1)
+	assert.NotEmpty(t, logger.find("received messages"))
+
+	if records := logger.find("delete batch flushed"); assert.Len(t, records, 1) {
+		assert.Equal(t, "close", records[0].keyvals[LogKeyReason])
+	}
+
+	if records := logger.find("delete failed"); assert.Len(t, records, 1) {
+		assert.Equal(t, LogWarn, records[0].level)
+		assert.Equal(t, aws.StringValue(queue.QueueUrl), records[0].keyvals[LogKeyQueueURL])
+		assert.Equal(t, "id", records[0].keyvals[LogKeyMessageID])
+		assert.Equal(t, sqs.ErrCodeReceiptHandleIsInvalid, records[0].keyvals[LogKeyCode])
+	}
+}
@@ -0,0 +1,67 @@
+package sqsch
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+
+	"github.com/bendrucker/sqs-receive-channel/pkg/batch"
+)
+
+// Metrics records instrumentation for a Dispatch. Its methods are called synchronously from
+// multiple goroutines and should not block.
+type Metrics interface {
+	// Received is called after each successful ReceiveMessage request with the number of
+	// messages it returned, which is zero for an empty receive
+	Received(count int)
+	// ReceiveBuffer is called whenever receive capacity is checked with the number of messages
+	// waiting in the receive channel and its capacity
+	ReceiveBuffer(length, capacity int)
+	// DeleteBatch is called when a batch of deletes is flushed with its size and whether it was
+	// flushed because it was full, because Delete.Interval elapsed, or because of Shutdown
+	DeleteBatch(size int, reason batch.Reason)
+	// DeleteFailed is called for each message that could not be deleted with the SQS error code
+	DeleteFailed(code string)
+	// APICall is called with the duration and error of each SQS API request
+	APICall(operation string, duration time.Duration, err error)
+}
+
+// NopMetrics is a Metrics that discards everything. It is the default.
+type NopMetrics struct{}
+
+// Received does nothing
+func (NopMetrics) Received(count int) {}
+
+// ReceiveBuffer does nothing
+func (NopMetrics) ReceiveBuffer(length, capacity int) {}
+
+// DeleteBatch does nothing
+func (NopMetrics) DeleteBatch(size int, reason batch.Reason) {}
+
+// DeleteFailed does nothing
+func (NopMetrics) DeleteFailed(code string) {}
+
+// APICall does nothing
+func (NopMetrics) APICall(operation string, duration time.Duration, err error) {}
+
+// ErrCodeUnknown is the code reported to Metrics.DeleteFailed when a request fails
+// with an error that is not an awserr.Error
+const ErrCodeUnknown = "Unknown"
+
+// observe records an SQS API request that started at start
+func (d *Dispatch) observe(operation string, start time.Time, err error) {
+	d.Options.Metrics.APICall(operation, time.Since(start), err)
+}
+
+// errorCode returns the SQS error code of err
+func errorCode(err error) string {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code()
+	}
+
+	if failure, ok := err.(*BatchDeleteError); ok {
+		return failure.Code
+	}
+
+	return ErrCodeUnknown
+}
@@ -0,0 +1,104 @@
+package sqsch
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/bendrucker/sqs-receive-channel/fake"
+	"github.com/bendrucker/sqs-receive-channel/pkg/batch"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder is a Metrics that records its calls
+type recorder struct {
+	mutex    sync.Mutex
+	received []int
+	buffer   int
+	batches  map[batch.Reason]int
+	failures map[string]int
+	calls    map[string]int
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		batches:  make(map[batch.Reason]int),
+		failures: make(map[string]int),
+		calls:    make(map[string]int),
+	}
+}
+
+func (r *recorder) Received(count int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.received = append(r.received, count)
+}
+
+func (r *recorder) ReceiveBuffer(length, capacity int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.buffer = capacity
+}
+
+func (r *recorder) DeleteBatch(size int, reason batch.Reason) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.batches[reason] += size
+}
+
+func (r *recorder) DeleteFailed(code string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.failures[code]++
+}
+
+func (r *recorder) APICall(operation string, duration time.Duration, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls[operation]++
+}
+
+func TestMetrics(t *testing.T) {
+	sqsapi := fake.New(fake.Options{})
+	queue, err := sqsapi.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String("queue")})
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err := sqsapi.SendMessage(&sqs.SendMessageInput{QueueUrl: queue.QueueUrl, MessageBody: aws.String("hello")})
+		assert.NoError(t, err)
+	}
+
+	metrics := newRecorder()
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: queue.QueueUrl}, BufferSize: 2},
+		Delete:  DeleteOptions{Interval: time.Hour},
+		Errors:  ErrorOptions{Handler: func(error) {}},
+		Metrics: metrics,
+	})
+	dispatch.Start(context.Background())
+
+	dispatch.Deletes() <- <-dispatch.Receives()
+	dispatch.Deletes() <- &sqs.Message{ReceiptHandle: aws.String("invalid")}
+	dispatch.Deletes() <- <-dispatch.Receives()
+
+	assert.NoError(t, dispatch.Shutdown(context.Background()))
+
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	total := 0
+	for _, count := range metrics.received {
+		total += count
+	}
+
+	assert.Equal(t, 2, total)
+	assert.Equal(t, 2, metrics.buffer)
+	assert.Equal(t, map[batch.Reason]int{batch.ReasonClose: 3}, metrics.batches)
+	assert.Equal(t, map[string]int{sqs.ErrCodeReceiptHandleIsInvalid: 1}, metrics.failures)
+	assert.Equal(t, 1, metrics.calls["DeleteMessageBatch"])
+	assert.NotZero(t, metrics.calls["ReceiveMessage"])
+}
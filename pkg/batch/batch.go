@@ -0,0 +1,141 @@
+package batch
+
+import (
+	"time"
+)
+
+// New reads values from the input channel and groups them into batches.
+// A batch is sent to the returned channel as soon as it contains size values
+// or once interval has elapsed since its first value was added, whichever
+// happens first. When the input channel is closed, any pending values are
+// flushed as a final batch and the returned channel is closed.
+func New(input <-chan interface{}, size int, interval time.Duration) <-chan []interface{} {
+	return NewLimited(input, size, interval, 0, nil)
+}
+
+// WeightFunc returns the weight of a value, such as its size in bytes
+type WeightFunc func(value interface{}) int
+
+// NewLimited groups values into batches like New, but also limits the total weight of each batch.
+// A pending batch is flushed before adding a value that would make its total weight exceed limit.
+// A value that exceeds limit on its own is sent in a batch by itself. If weigh is nil or limit is
+// zero, batches are only limited by size.
+func NewLimited(input <-chan interface{}, size int, interval time.Duration, limit int, weigh WeightFunc) <-chan []interface{} {
+	return NewWithOptions(input, Options{Size: size, Interval: interval, Limit: limit, WeightFunc: weigh})
+}
+
+// Options represents the configurable parameters for NewWithOptions
+type Options struct {
+	Size     int
+	Interval time.Duration
+
+	// Limit is the maximum total weight of a batch, as returned by WeightFunc
+	Limit      int
+	WeightFunc WeightFunc
+
+	// FlushFunc is called with the size of each batch and the reason it was flushed,
+	// before the batch is sent
+	FlushFunc FlushFunc
+}
+
+// Reason is the reason a batch was flushed
+type Reason int
+
+const (
+	// ReasonSize means the batch reached Size values
+	ReasonSize Reason = iota
+	// ReasonInterval means Interval elapsed since the batch's first value was added
+	ReasonInterval
+	// ReasonLimit means the next value would have exceeded Limit
+	ReasonLimit
+	// ReasonClose means the input channel was closed
+	ReasonClose
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonSize:
+		return "size"
+	case ReasonInterval:
+		return "interval"
+	case ReasonLimit:
+		return "limit"
+	case ReasonClose:
+		return "close"
+	default:
+		return "unknown"
+	}
+}
+
+// FlushFunc is called when a batch is flushed
+type FlushFunc func(size int, reason Reason)
+
+// NewWithOptions groups values into batches like NewLimited, and reports each flush to Options.FlushFunc
+func NewWithOptions(input <-chan interface{}, options Options) <-chan []interface{} {
+	if options.Size <= 0 {
+		panic("size must be > 0")
+	}
+
+	output := make(chan []interface{})
+
+	go func() {
+		defer close(output)
+
+		var (
+			batch   []interface{}
+			weight  int
+			timer   *time.Timer
+			timeout <-chan time.Time
+		)
+
+		flush := func(reason Reason) {
+			if timer != nil {
+				timer.Stop()
+				timer, timeout = nil, nil
+			}
+
+			if len(batch) > 0 {
+				if options.FlushFunc != nil {
+					options.FlushFunc(len(batch), reason)
+				}
+
+				output <- batch
+				batch, weight = nil, 0
+			}
+		}
+
+		for {
+			select {
+			case value, ok := <-input:
+				if !ok {
+					flush(ReasonClose)
+					return
+				}
+
+				if options.Limit > 0 && options.WeightFunc != nil {
+					w := options.WeightFunc(value)
+					if len(batch) > 0 && weight+w > options.Limit {
+						flush(ReasonLimit)
+					}
+
+					weight += w
+				}
+
+				if len(batch) == 0 {
+					timer = time.NewTimer(options.Interval)
+					timeout = timer.C
+				}
+
+				batch = append(batch, value)
+
+				if len(batch) == options.Size {
+					flush(ReasonSize)
+				}
+			case <-timeout:
+				flush(ReasonInterval)
+			}
+		}
+	}()
+
+	return output
+}
@@ -0,0 +1,103 @@
+package batch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchSize(t *testing.T) {
+	input := make(chan interface{})
+	batches := New(input, 2, time.Hour)
+
+	go func() {
+		input <- 1
+		input <- 2
+	}()
+
+	assert.Equal(t, []interface{}{1, 2}, <-batches)
+}
+
+func TestBatchInterval(t *testing.T) {
+	input := make(chan interface{})
+	batches := New(input, 10, time.Millisecond)
+
+	input <- 1
+
+	assert.Equal(t, []interface{}{1}, <-batches)
+}
+
+func TestBatchClose(t *testing.T) {
+	input := make(chan interface{})
+	batches := New(input, 10, time.Hour)
+
+	input <- 1
+	input <- 2
+	close(input)
+
+	assert.Equal(t, []interface{}{1, 2}, <-batches)
+
+	_, ok := <-batches
+	assert.False(t, ok)
+}
+
+func TestBatchPanicInvalid(t *testing.T) {
+	assert.Panics(t, func() {
+		New(make(chan interface{}), 0, time.Second)
+	})
+}
+
+func TestBatchLimit(t *testing.T) {
+	input := make(chan interface{})
+	batches := NewLimited(input, 10, time.Hour, 5, func(value interface{}) int {
+		return value.(int)
+	})
+
+	go func() {
+		input <- 2
+		input <- 3
+		input <- 1
+		input <- 6
+		close(input)
+	}()
+
+	assert.Equal(t, []interface{}{2, 3}, <-batches)
+	assert.Equal(t, []interface{}{1}, <-batches)
+	assert.Equal(t, []interface{}{6}, <-batches)
+}
+
+func TestBatchFlushReason(t *testing.T) {
+	type flush struct {
+		size   int
+		reason Reason
+	}
+
+	input := make(chan interface{})
+	flushes := make(chan flush, 3)
+	batches := NewWithOptions(input, Options{
+		Size:     2,
+		Interval: 20 * time.Millisecond,
+		FlushFunc: func(size int, reason Reason) {
+			flushes <- flush{size, reason}
+		},
+	})
+
+	input <- 1
+	input <- 2
+	<-batches
+	assert.Equal(t, flush{2, ReasonSize}, <-flushes)
+
+	input <- 3
+	<-batches
+	assert.Equal(t, flush{1, ReasonInterval}, <-flushes)
+
+	go func() {
+		input <- 4
+		close(input)
+	}()
+
+	<-batches
+	assert.Equal(t, flush{1, ReasonClose}, <-flushes)
+	assert.Equal(t, "interval", ReasonInterval.String())
+}
@@ -0,0 +1,62 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Dir is a blob store backed by a directory on the local filesystem.
+// Each blob is stored in a file named by its key within a subdirectory named by its bucket.
+type Dir string
+
+// Get reads the blob stored in bucket with key
+func (d Dir) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	path, err := d.path(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(path)
+}
+
+// Put stores data in bucket with key, replacing any existing blob
+func (d Dir) Put(ctx context.Context, bucket, key string, data []byte) error {
+	path, err := d.path(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Delete removes the blob stored in bucket with key. Deleting a blob that does not exist is not an error.
+func (d Dir) Delete(ctx context.Context, bucket, key string) error {
+	path, err := d.path(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// path returns the file path for a blob, rejecting names that would escape the directory
+func (d Dir) path(bucket, key string) (string, error) {
+	name := bucket + "/" + key
+	if bucket == "" || !fs.ValidPath(name) {
+		return "", fmt.Errorf("invalid blob name: %q", name)
+	}
+
+	return filepath.Join(string(d), filepath.FromSlash(name)), nil
+}
@@ -0,0 +1,35 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDir(t *testing.T) {
+	ctx := context.TODO()
+	dir := Dir(t.TempDir())
+
+	assert.NoError(t, dir.Put(ctx, "bucket", "path/to/key", []byte("hello")))
+
+	data, err := dir.Get(ctx, "bucket", "path/to/key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), data)
+
+	assert.NoError(t, dir.Delete(ctx, "bucket", "path/to/key"))
+	assert.NoError(t, dir.Delete(ctx, "bucket", "path/to/key"))
+
+	_, err = dir.Get(ctx, "bucket", "path/to/key")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestDirInvalid(t *testing.T) {
+	ctx := context.TODO()
+	dir := Dir(t.TempDir())
+
+	assert.EqualError(t, dir.Put(ctx, "bucket", "../key", nil), `invalid blob name: "bucket/../key"`)
+	assert.EqualError(t, dir.Delete(ctx, "", "key"), `invalid blob name: "/key"`)
+}
@@ -0,0 +1,31 @@
+module github.com/bendrucker/sqs-receive-channel/pkg/prom
+
+go 1.18
+
+require (
+	github.com/bendrucker/sqs-receive-channel v0.1.0
+	github.com/prometheus/client_golang v1.14.0
+	github.com/stretchr/testify v1.8.2
+)
+
+require (
+	github.com/aws/aws-sdk-go v1.20.15 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/jmespath/go-jmespath v0.0.0-20180206201540-c2b33e8439af // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/prometheus/client_model v0.3.0 // indirect
+	github.com/prometheus/common v0.37.0 // indirect
+	github.com/prometheus/procfs v0.8.0 // indirect
+	go.opentelemetry.io/otel v1.14.0 // indirect
+	go.opentelemetry.io/otel/trace v1.14.0 // indirect
+	golang.org/x/sys v0.5.0 // indirect
+	google.golang.org/protobuf v1.28.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// replaced for local development; consumers resolve the required release
+replace github.com/bendrucker/sqs-receive-channel => ../..
@@ -0,0 +1,138 @@
+// Package prom provides a Prometheus implementation of sqsch.Metrics.
+package prom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/bendrucker/sqs-receive-channel/pkg/batch"
+)
+
+// Options configures Prometheus metrics
+type Options struct {
+	// Namespace prefixes metric names (default: sqsch)
+	Namespace string
+	// Registerer registers the metrics (default: prometheus.DefaultRegisterer)
+	Registerer prometheus.Registerer
+	// Buckets are the API request duration histogram buckets in seconds (default: prometheus.DefBuckets)
+	Buckets []float64
+	// ConstLabels are added to every metric, such as the name of the queue
+	ConstLabels prometheus.Labels
+}
+
+// Defaults sets default values
+func (o *Options) Defaults() {
+	if o.Namespace == "" {
+		o.Namespace = "sqsch"
+	}
+
+	if o.Registerer == nil {
+		o.Registerer = prometheus.DefaultRegisterer
+	}
+
+	if o.Buckets == nil {
+		o.Buckets = prometheus.DefBuckets
+	}
+}
+
+// Metrics records Dispatch instrumentation as Prometheus metrics
+type Metrics struct {
+	receives       prometheus.Counter
+	emptyReceives  prometheus.Counter
+	messages       prometheus.Histogram
+	bufferLength   prometheus.Gauge
+	bufferCapacity prometheus.Gauge
+	deleteBatches  *prometheus.HistogramVec
+	deleteFailures *prometheus.CounterVec
+	requests       *prometheus.HistogramVec
+}
+
+// New creates and registers Prometheus metrics
+func New(options Options) (*Metrics, error) {
+	options.Defaults()
+
+	opts := func(name, help string) prometheus.Opts {
+		return prometheus.Opts{Namespace: options.Namespace, Name: name, Help: help, ConstLabels: options.ConstLabels}
+	}
+
+	histogram := func(name, help string, buckets []float64) prometheus.HistogramOpts {
+		o := opts(name, help)
+		return prometheus.HistogramOpts{Namespace: o.Namespace, Name: o.Name, Help: o.Help, ConstLabels: o.ConstLabels, Buckets: buckets}
+	}
+
+	m := &Metrics{
+		receives:       prometheus.NewCounter(prometheus.CounterOpts(opts("receive_requests_total", "ReceiveMessage requests that succeeded."))),
+		emptyReceives:  prometheus.NewCounter(prometheus.CounterOpts(opts("receive_empty_total", "ReceiveMessage requests that returned no messages."))),
+		messages:       prometheus.NewHistogram(histogram("receive_messages", "Messages returned per ReceiveMessage request.", prometheus.LinearBuckets(0, 1, 11))),
+		bufferLength:   prometheus.NewGauge(prometheus.GaugeOpts(opts("receive_buffer_length", "Messages waiting in the receive channel."))),
+		bufferCapacity: prometheus.NewGauge(prometheus.GaugeOpts(opts("receive_buffer_capacity", "Capacity of the receive channel."))),
+		deleteBatches: prometheus.NewHistogramVec(
+			histogram("delete_batch_size", "Messages per delete batch by flush reason.", prometheus.LinearBuckets(1, 1, 10)),
+			[]string{"reason"},
+		),
+		deleteFailures: prometheus.NewCounterVec(
+			prometheus.CounterOpts(opts("delete_failures_total", "Messages that could not be deleted by error code.")),
+			[]string{"code"},
+		),
+		requests: prometheus.NewHistogramVec(
+			histogram("api_request_duration_seconds", "Duration of SQS API requests by operation and result.", options.Buckets),
+			[]string{"operation", "result"},
+		),
+	}
+
+	collectors := []prometheus.Collector{
+		m.receives,
+		m.emptyReceives,
+		m.messages,
+		m.bufferLength,
+		m.bufferCapacity,
+		m.deleteBatches,
+		m.deleteFailures,
+		m.requests,
+	}
+
+	for _, collector := range collectors {
+		if err := options.Registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// Received records a ReceiveMessage request
+func (m *Metrics) Received(count int) {
+	m.receives.Inc()
+	m.messages.Observe(float64(count))
+
+	if count == 0 {
+		m.emptyReceives.Inc()
+	}
+}
+
+// ReceiveBuffer records the occupancy of the receive channel
+func (m *Metrics) ReceiveBuffer(length, capacity int) {
+	m.bufferLength.Set(float64(length))
+	m.bufferCapacity.Set(float64(capacity))
+}
+
+// DeleteBatch records the size of a delete batch and why it was flushed
+func (m *Metrics) DeleteBatch(size int, reason batch.Reason) {
+	m.deleteBatches.WithLabelValues(reason.String()).Observe(float64(size))
+}
+
+// DeleteFailed records a message that could not be deleted
+func (m *Metrics) DeleteFailed(code string) {
+	m.deleteFailures.WithLabelValues(code).Inc()
+}
+
+// APICall records the duration of an SQS API request
+func (m *Metrics) APICall(operation string, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	m.requests.WithLabelValues(operation, result).Observe(duration.Seconds())
+}
@@ -0,0 +1,66 @@
+package prom
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	sqsch "github.com/bendrucker/sqs-receive-channel"
+	"github.com/bendrucker/sqs-receive-channel/pkg/batch"
+)
+
+var _ sqsch.Metrics = (*Metrics)(nil)
+
+func TestMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := New(Options{Registerer: registry})
+	assert.NoError(t, err)
+
+	metrics.Received(3)
+	metrics.Received(0)
+	metrics.ReceiveBuffer(1, 10)
+	metrics.DeleteBatch(10, batch.ReasonSize)
+	metrics.DeleteFailed("ReceiptHandleIsInvalid")
+	metrics.APICall("ReceiveMessage", time.Second, nil)
+	metrics.APICall("ReceiveMessage", time.Second, errors.New("failed"))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.receives))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.emptyReceives))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.bufferLength))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.deleteFailures.WithLabelValues("ReceiptHandleIsInvalid")))
+
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP sqsch_delete_batch_size Messages per delete batch by flush reason.
+# TYPE sqsch_delete_batch_size histogram
+sqsch_delete_batch_size_bucket{reason="size",le="1"} 0
+sqsch_delete_batch_size_bucket{reason="size",le="2"} 0
+sqsch_delete_batch_size_bucket{reason="size",le="3"} 0
+sqsch_delete_batch_size_bucket{reason="size",le="4"} 0
+sqsch_delete_batch_size_bucket{reason="size",le="5"} 0
+sqsch_delete_batch_size_bucket{reason="size",le="6"} 0
+sqsch_delete_batch_size_bucket{reason="size",le="7"} 0
+sqsch_delete_batch_size_bucket{reason="size",le="8"} 0
+sqsch_delete_batch_size_bucket{reason="size",le="9"} 0
+sqsch_delete_batch_size_bucket{reason="size",le="10"} 1
+sqsch_delete_batch_size_bucket{reason="size",le="+Inf"} 1
+sqsch_delete_batch_size_sum{reason="size"} 10
+sqsch_delete_batch_size_count{reason="size"} 1
+`), "sqsch_delete_batch_size"))
+
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.requests))
+}
+
+func TestRegisterTwice(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	_, err := New(Options{Registerer: registry})
+	assert.NoError(t, err)
+
+	_, err = New(Options{Registerer: registry})
+	assert.Error(t, err)
+}
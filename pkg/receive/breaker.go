@@ -0,0 +1,181 @@
+package receive
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// BackoffFunc returns how long to wait before the next request, given the number of
+// consecutive requests that have failed
+type BackoffFunc func(failures int) time.Duration
+
+// ExponentialBackoff returns a BackoffFunc that doubles the delay after each failure,
+// starting from base and capped at max, with full jitter applied.
+// For example, with base=100ms the third failure is followed by a random delay in [0s, 400ms).
+func ExponentialBackoff(base, max time.Duration) BackoffFunc {
+	return func(failures int) time.Duration {
+		delay := max
+		if failures < 1 {
+			failures = 1
+		}
+
+		if shift := uint(failures - 1); shift < 63 && base < max>>shift {
+			delay = base << shift
+		}
+
+		if delay <= 0 {
+			return 0
+		}
+
+		return time.Duration(rand.Int63n(int64(delay)))
+	}
+}
+
+// State is the state of the circuit breaker
+type State int
+
+const (
+	// StateClosed polls normally, backing off after failures
+	StateClosed State = iota
+	// StateOpen stops polling until BreakerOptions.Cooldown has passed
+	StateOpen
+	// StateHalfOpen allows a single probe request, which closes the breaker if it succeeds
+	// or opens it again if it fails
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// StateFunc is called when the circuit breaker changes state
+type StateFunc func(from, to State)
+
+// BreakerOptions configures the circuit breaker that stops polling after sustained failures.
+// It is disabled unless Threshold is set.
+type BreakerOptions struct {
+	// Threshold is the number of consecutive failed requests that opens the breaker
+	Threshold int
+	// Cooldown is how long the breaker stays open before a probe request (default: 30s)
+	Cooldown time.Duration
+	// StateFunc is called with every state change
+	StateFunc StateFunc
+}
+
+// Defaults sets default values
+func (bo *BreakerOptions) Defaults() {
+	if bo.Cooldown == 0 {
+		bo.Cooldown = 30 * time.Second
+	}
+}
+
+// Enabled returns whether the circuit breaker is enabled
+func (bo *BreakerOptions) Enabled() bool {
+	return bo.Threshold > 0
+}
+
+// breaker tracks consecutive failures and decides when requests may be made
+type breaker struct {
+	backoff BackoffFunc
+	options BreakerOptions
+
+	mutex    sync.Mutex
+	state    State
+	failures int
+	// until is the earliest time of the next request
+	until time.Time
+	// probing is set while the probe request of a half-open breaker is in flight
+	probing bool
+}
+
+// allow returns whether a request may start at now. If the breaker is open and its cooldown
+// has passed, it transitions to half-open and allows a single probe.
+func (b *breaker) allow(now time.Time) (bool, func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if now.Before(b.until) {
+		return false, nil
+	}
+
+	switch b.state {
+	case StateOpen:
+		b.probing = true
+		return true, b.transition(StateHalfOpen)
+	case StateHalfOpen:
+		return !b.probing, nil
+	default:
+		return true, nil
+	}
+}
+
+// record updates the breaker with the result of a request made at now
+func (b *breaker) record(now time.Time, err error) func() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.probing = false
+
+	if err == nil {
+		b.failures = 0
+		b.until = time.Time{}
+		return b.transition(StateClosed)
+	}
+
+	b.failures++
+
+	if b.options.Enabled() && (b.state == StateHalfOpen || b.failures >= b.options.Threshold) {
+		b.until = now.Add(b.options.Cooldown)
+		return b.transition(StateOpen)
+	}
+
+	if b.state == StateClosed {
+		b.until = now.Add(b.backoff(b.failures))
+	}
+
+	return nil
+}
+
+// transition changes the state and returns a function that notifies StateFunc, to be
+// called once the mutex is released
+func (b *breaker) transition(to State) func() {
+	from := b.state
+	if from == to {
+		return nil
+	}
+
+	b.state = to
+
+	if b.options.StateFunc == nil {
+		return nil
+	}
+
+	return func() {
+		b.options.StateFunc(from, to)
+	}
+}
+
+// State returns the current state of the circuit breaker
+func (r *Receive) State() State {
+	r.breaker.mutex.Lock()
+	defer r.breaker.mutex.Unlock()
+
+	return r.breaker.state
+}
+
+// notify calls a state change notification returned by the breaker, if any
+func notify(fn func()) {
+	if fn != nil {
+		fn()
+	}
+}
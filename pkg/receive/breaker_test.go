@@ -0,0 +1,158 @@
+package receive
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(100*time.Millisecond, time.Second)
+
+	cases := []struct {
+		failures int
+		max      time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{5, time.Second},
+		{100, time.Second},
+	}
+
+	for _, c := range cases {
+		for i := 0; i < 100; i++ {
+			delay := backoff(c.failures)
+			assert.True(t, delay >= 0 && delay < c.max, "failures=%d delay=%s", c.failures, delay)
+		}
+	}
+}
+
+func TestReceiveBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int32
+	r := New(Options{
+		MaxCount: 1,
+		DoFunc: func(count Request) ([]interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			return nil, errors.New("oops")
+		},
+		CountFunc: func() int {
+			return 1
+		},
+		Backoff: func(failures int) time.Duration {
+			return 50 * time.Millisecond
+		},
+	})
+
+	r.Start(ctx)
+	go func() {
+		for range r.Errors() {
+		}
+	}()
+
+	time.Sleep(120 * time.Millisecond)
+	assert.True(t, atomic.LoadInt32(&calls) <= 4, "waits between failed requests, got %d", atomic.LoadInt32(&calls))
+	assert.Equal(t, StateClosed, r.State())
+}
+
+func TestReceiveBreaker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mutex sync.Mutex
+	var transitions [][2]State
+	var healthy int32
+
+	r := New(Options{
+		MaxCount: 1,
+		DoFunc: func(count Request) ([]interface{}, error) {
+			if atomic.LoadInt32(&healthy) == 1 {
+				return nil, nil
+			}
+
+			return nil, errors.New("oops")
+		},
+		CountFunc: func() int {
+			return 1
+		},
+		Backoff: func(failures int) time.Duration {
+			return 0
+		},
+		Breaker: BreakerOptions{
+			Threshold: 3,
+			Cooldown:  50 * time.Millisecond,
+			StateFunc: func(from, to State) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				transitions = append(transitions, [2]State{from, to})
+			},
+		},
+	})
+
+	r.Start(ctx)
+
+	for i := 0; i < 3; i++ {
+		<-r.Errors()
+	}
+
+	assert.Eventually(t, func() bool { return r.State() == StateOpen }, time.Second, time.Millisecond)
+
+	// the first probe fails and reopens the breaker
+	<-r.Errors()
+	atomic.StoreInt32(&healthy, 1)
+
+	assert.Eventually(t, func() bool { return r.State() == StateClosed }, time.Second, time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	assert.Equal(t, [][2]State{
+		{StateClosed, StateOpen},
+		{StateOpen, StateHalfOpen},
+		{StateHalfOpen, StateOpen},
+		{StateOpen, StateHalfOpen},
+		{StateHalfOpen, StateClosed},
+	}, transitions)
+}
+
+func TestBreakerHalfOpenSingleProbe(t *testing.T) {
+	now := time.Now()
+	b := &breaker{
+		backoff: func(int) time.Duration { return 0 },
+		options: BreakerOptions{Threshold: 1, Cooldown: time.Second},
+	}
+
+	b.record(now, errors.New("oops"))
+	assert.Equal(t, StateOpen, b.state)
+
+	ok, _ := b.allow(now)
+	assert.False(t, ok, "open during cooldown")
+
+	ok, _ = b.allow(now.Add(time.Second))
+	assert.True(t, ok, "probe after cooldown")
+	assert.Equal(t, StateHalfOpen, b.state)
+
+	ok, _ = b.allow(now.Add(time.Second))
+	assert.False(t, ok, "one probe at a time")
+
+	b.record(now.Add(time.Second), nil)
+	assert.Equal(t, StateClosed, b.state)
+
+	ok, _ = b.allow(now.Add(time.Second))
+	assert.True(t, ok)
+}
+
+func TestStateString(t *testing.T) {
+	assert.Equal(t, "closed", StateClosed.String())
+	assert.Equal(t, "open", StateOpen.String())
+	assert.Equal(t, "half-open", StateHalfOpen.String())
+	assert.Equal(t, "unknown", State(10).String())
+}
@@ -4,12 +4,17 @@ import (
 	"context"
 	"math"
 	"sync"
+	"time"
 )
 
-// Receive manages a loop that manages calls to a function (DoFunc)
-// and outputs results to channels (results and errors).
+// Receive manages independent pollers that make calls to a function (DoFunc)
+// and output results to channels (results and errors).
 // It manages changing concurrency over time by executing CountFunc
-// and splitting that count over calls to DoFunc with count <= MaxCount
+// and splitting that count over pollers that call DoFunc with count <= MaxCount.
+// Each poller re-issues its request as soon as the previous one completes, so a
+// slow request never holds up capacity that is claimed by another poller.
+// After a failed request, no requests are made until the delay returned by Backoff
+// has passed, and the optional circuit breaker stops polling after sustained failures.
 type Receive struct {
 	Options
 
@@ -17,7 +22,11 @@ type Receive struct {
 	errors  chan error
 	done    chan struct{}
 
-	started bool
+	started  bool
+	mutex    sync.Mutex
+	inFlight int
+	pollers  sync.WaitGroup
+	breaker  *breaker
 }
 
 // Options represents the configurable parameters for Receive
@@ -25,6 +34,16 @@ type Options struct {
 	MaxCount  int
 	CountFunc CountFunc
 	DoFunc    DoFunc
+
+	// Interval is how long to wait before checking CountFunc again when there is no
+	// unclaimed capacity (default: 10ms)
+	Interval time.Duration
+
+	// Backoff is how long to wait after consecutive failed requests
+	// (default: ExponentialBackoff(100ms, 30s))
+	Backoff BackoffFunc
+	// Breaker stops polling after sustained failures
+	Breaker BreakerOptions
 }
 
 // CountFunc returns the number of results that can be received
@@ -42,15 +61,26 @@ func New(o Options) *Receive {
 		panic("MaxCount must be > 0")
 	}
 
+	if o.Interval == 0 {
+		o.Interval = 10 * time.Millisecond
+	}
+
+	if o.Backoff == nil {
+		o.Backoff = ExponentialBackoff(100*time.Millisecond, 30*time.Second)
+	}
+
+	o.Breaker.Defaults()
+
 	return &Receive{
 		Options: o,
 		results: make(chan interface{}),
 		errors:  make(chan error),
 		done:    make(chan struct{}, 1),
+		breaker: &breaker{backoff: o.Backoff, options: o.Breaker},
 	}
 }
 
-// Start executes a new goroutine that executes a receive loop
+// Start executes a new goroutine that starts pollers whenever there is unclaimed capacity
 func (r *Receive) Start(ctx context.Context) {
 	if r.started {
 		panic("receive already started")
@@ -59,53 +89,110 @@ func (r *Receive) Start(ctx context.Context) {
 	}
 
 	go func() {
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+
 		for {
 			select {
 			case <-ctx.Done():
+				r.pollers.Wait()
 				close(r.results)
 				close(r.errors)
 				close(r.done)
 				return
-			default:
-				r.Run()
+			case <-timer.C:
+				for count := r.claim(); count > 0; count = r.claim() {
+					r.pollers.Add(1)
+					go r.poll(ctx, Request(count))
+				}
+
+				timer.Reset(r.Interval)
 			}
 		}
 	}()
 }
 
-// Run executes one run-through of the receive loop, executing the number of
-// requests specified by CountFunc
+// poll executes a request and re-issues it, sized from the capacity that is
+// still unclaimed, until there is no capacity left or ctx is canceled
+func (r *Receive) poll(ctx context.Context, request Request) {
+	defer r.pollers.Done()
+
+	for request > 0 {
+		r.Do(request)
+		r.release(int(request))
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		request = Request(r.claim())
+	}
+}
+
+// claim reserves up to MaxCount of the capacity reported by CountFunc that
+// is not already claimed by an in-flight request and returns the claimed count.
+// It returns 0 while backing off or while the circuit breaker is open.
+func (r *Receive) claim() int {
+	var changed func()
+	defer func() { notify(changed) }()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	count := r.CountFunc() - r.inFlight
+	if count > r.MaxCount {
+		count = r.MaxCount
+	}
+
+	if count <= 0 {
+		return 0
+	}
+
+	var ok bool
+	if ok, changed = r.breaker.allow(time.Now()); !ok {
+		return 0
+	}
+
+	r.inFlight += count
+	return count
+}
+
+// release returns capacity claimed by a completed request
+func (r *Receive) release(count int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.inFlight -= count
+}
+
+// Run executes one run-through of the receive loop, executing one request for each
+// claim on the capacity reported by CountFunc and waiting for them to complete
+//
+// Deprecated: Start runs pollers that re-issue requests independently. Run is kept for
+// callers that drive requests themselves.
 func (r *Receive) Run() {
 	wg := &sync.WaitGroup{}
 
-	for _, request := range r.Requests(r.CountFunc()) {
+	for count := r.claim(); count > 0; count = r.claim() {
 		wg.Add(1)
 
 		go func(req Request) {
+			defer wg.Done()
+
 			r.Do(req)
-			wg.Done()
-		}(request)
+			r.release(int(req))
+		}(Request(count))
 	}
 
 	wg.Wait()
 }
 
-// Do executes a request, calling DoFunc and writing its result/error to the
-// corresponding channels
-func (r *Receive) Do(request Request) {
-	if results, err := r.DoFunc(request); err != nil {
-		r.errors <- err
-	} else {
-		for _, result := range results {
-			r.results <- result
-		}
-	}
-}
-
 // Requests creates a slice of requests sized based on the supplied count and
 // the configured MaxCount.
 // Example: count=25, MaxCount=10
 // Result: [Request(10), Request(10), Request(5)]
+//
+// Deprecated: pollers size each request from the capacity they claim.
 func (r *Receive) Requests(count int) []Request {
 	requests := make([]Request, int(math.Ceil(float64(count)/float64(r.MaxCount))))
 
@@ -119,6 +206,21 @@ func (r *Receive) Requests(count int) []Request {
 	return requests
 }
 
+// Do executes a request, calling DoFunc and writing its result/error to the
+// corresponding channels
+func (r *Receive) Do(request Request) {
+	results, err := r.DoFunc(request)
+	notify(r.breaker.record(time.Now(), err))
+
+	if err != nil {
+		r.errors <- err
+	} else {
+		for _, result := range results {
+			r.results <- result
+		}
+	}
+}
+
 // Results returns a read-only copy of the results channel
 func (r *Receive) Results() <-chan interface{} {
 	return r.results
@@ -3,6 +3,7 @@ package receive
 import (
 	"context"
 	"errors"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -63,6 +64,82 @@ func TestReceiveRequests(t *testing.T) {
 	}
 }
 
+func TestReceiveRun(t *testing.T) {
+	r := New(Options{
+		MaxCount: 1,
+		DoFunc: func(count Request) ([]interface{}, error) {
+			return []interface{}{int(count)}, nil
+		},
+		CountFunc: func() int {
+			return 2
+		},
+	})
+
+	go r.Run()
+
+	assert.Equal(t, 1, <-r.Results())
+	assert.Equal(t, 1, <-r.Results())
+}
+
+func TestReceiveClaims(t *testing.T) {
+	cases := []struct {
+		max      int
+		count    int
+		expected []int
+	}{
+		{10, 20, []int{10, 10, 0}},
+		{10, 25, []int{10, 10, 5, 0}},
+		{10, 5, []int{5, 0}},
+	}
+
+	for _, c := range cases {
+		count := c.count
+		r := New(Options{
+			MaxCount: c.max,
+			CountFunc: func() int {
+				return count
+			},
+		})
+
+		claims := []int{}
+		for range c.expected {
+			claims = append(claims, r.claim())
+		}
+
+		assert.Equal(t, c.expected, claims)
+	}
+}
+
+func TestReceiveIndependentPollers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int32
+	fast := make(chan Request, 10)
+
+	r := New(Options{
+		MaxCount: 1,
+		DoFunc: func(count Request) ([]interface{}, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-ctx.Done()
+				return nil, nil
+			}
+
+			fast <- count
+			return nil, nil
+		},
+		CountFunc: func() int {
+			return 2
+		},
+	})
+
+	r.Start(ctx)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, Request(1), <-fast)
+	}
+}
+
 func TestReceiveDone(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	r := New(Options{
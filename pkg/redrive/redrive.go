@@ -0,0 +1,36 @@
+package redrive
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Policy is the parsed value of the RedrivePolicy queue attribute
+type Policy struct {
+	DeadLetterTargetArn string
+	// MaxReceiveCount is the number of receives after which a message is moved to the dead-letter queue
+	MaxReceiveCount int
+}
+
+// Parse parses the value of the RedrivePolicy queue attribute, whose maxReceiveCount may be a
+// number or a string. It returns an error if the dead-letter queue is missing or
+// maxReceiveCount is less than 1.
+func Parse(value string) (*Policy, error) {
+	var raw struct {
+		DeadLetterTargetArn string          `json:"deadLetterTargetArn"`
+		MaxReceiveCount     json.RawMessage `json:"maxReceiveCount"`
+	}
+
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return nil, err
+	}
+
+	count, err := strconv.Atoi(strings.Trim(string(raw.MaxReceiveCount), `"`))
+	if err != nil || count < 1 || raw.DeadLetterTargetArn == "" {
+		return nil, fmt.Errorf("invalid redrive policy: %s", value)
+	}
+
+	return &Policy{DeadLetterTargetArn: raw.DeadLetterTargetArn, MaxReceiveCount: count}, nil
+}
@@ -0,0 +1,29 @@
+package redrive
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	policy, err := Parse(`{"deadLetterTargetArn":"arn:aws:sqs:us-east-1:000000000000:dlq","maxReceiveCount":"5"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, &Policy{DeadLetterTargetArn: "arn:aws:sqs:us-east-1:000000000000:dlq", MaxReceiveCount: 5}, policy)
+
+	policy, err = Parse(`{"deadLetterTargetArn":"arn:aws:sqs:us-east-1:000000000000:dlq","maxReceiveCount":3}`)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, policy.MaxReceiveCount)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, value := range []string{
+		`not json`,
+		`{"deadLetterTargetArn":"arn:aws:sqs:us-east-1:000000000000:dlq","maxReceiveCount":"many"}`,
+		`{"deadLetterTargetArn":"arn:aws:sqs:us-east-1:000000000000:dlq","maxReceiveCount":0}`,
+		`{"maxReceiveCount":"5"}`,
+	} {
+		_, err := Parse(value)
+		assert.Error(t, err, value)
+	}
+}
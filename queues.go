@@ -0,0 +1,131 @@
+package sqsch
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Queue is one of multiple queues that a Dispatch receives from
+type Queue struct {
+	URL *string
+	// Name is resolved to URL with GetQueueUrl when the Dispatch is created
+	Name string
+	// Weight is the relative share of receive requests for the queue when Receive.Priority
+	// is PriorityWeighted (default: 1)
+	Weight int
+}
+
+// Priority determines the order in which multiple queues are received from
+type Priority int
+
+const (
+	// PriorityStrict receives from queues in the order they are listed. A queue is only
+	// received from when every queue before it is empty.
+	PriorityStrict Priority = iota
+	// PriorityWeighted receives from queues in a random order for each request, where the
+	// chance of a queue going first is proportional to its Weight
+	PriorityWeighted
+)
+
+// order returns the queue URLs in the order they should be received from
+func (ro *ReceiveOptions) order() []*string {
+	urls := make([]*string, len(ro.Queues))
+
+	if ro.Priority != PriorityWeighted {
+		for i, queue := range ro.Queues {
+			urls[i] = queue.URL
+		}
+
+		return urls
+	}
+
+	remaining := append([]Queue{}, ro.Queues...)
+	for i := range urls {
+		total := 0
+		for _, queue := range remaining {
+			total += weight(queue)
+		}
+
+		n := rand.Intn(total)
+		for j, queue := range remaining {
+			if n -= weight(queue); n < 0 {
+				urls[i] = queue.URL
+				remaining = append(remaining[:j], remaining[j+1:]...)
+				break
+			}
+		}
+	}
+
+	return urls
+}
+
+func weight(queue Queue) int {
+	if queue.Weight <= 0 {
+		return 1
+	}
+
+	return queue.Weight
+}
+
+// MessageQueueURL returns the URL of the queue that a message was received from
+func (d *Dispatch) MessageQueueURL(message *sqs.Message) *string {
+	if url := d.origins.get(message); url != nil {
+		return url
+	}
+
+	return d.QueueURL()
+}
+
+// byQueue groups the indexes of messages by the queue they were received from,
+// in the order each queue first appears
+func (d *Dispatch) byQueue(messages []*sqs.Message) ([]*string, map[string][]int) {
+	var urls []*string
+	indexes := make(map[string][]int)
+
+	for i, message := range messages {
+		url := d.MessageQueueURL(message)
+		key := aws.StringValue(url)
+
+		if _, ok := indexes[key]; !ok {
+			urls = append(urls, url)
+		}
+
+		indexes[key] = append(indexes[key], i)
+	}
+
+	return urls, indexes
+}
+
+// origins tracks the queue URLs of messages received from multiple queues by receipt handle
+type origins struct {
+	mutex sync.Mutex
+	urls  map[string]*string
+}
+
+func newOrigins() *origins {
+	return &origins{urls: make(map[string]*string)}
+}
+
+func (o *origins) add(message *sqs.Message, url *string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.urls[aws.StringValue(message.ReceiptHandle)] = url
+}
+
+func (o *origins) get(message *sqs.Message) *string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return o.urls[aws.StringValue(message.ReceiptHandle)]
+}
+
+func (o *origins) remove(message *sqs.Message) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	delete(o.urls, aws.StringValue(message.ReceiptHandle))
+}
@@ -0,0 +1,90 @@
+package sqsch
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiveQueues(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	high, low := aws.String("http://foo.bar/high"), aws.String("http://foo.bar/low")
+	var received int32
+
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+			if aws.Int64Value(input.WaitTimeSeconds) > 0 {
+				assert.Equal(t, high, input.QueueUrl)
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+
+			output := &sqs.ReceiveMessageOutput{}
+			if aws.StringValue(input.QueueUrl) == aws.StringValue(low) && atomic.AddInt32(&received, 1) == 1 {
+				output.Messages = []*sqs.Message{{ReceiptHandle: aws.String("handle")}}
+			}
+
+			return output, nil
+		}).
+		AnyTimes()
+
+	sqsapi.
+		EXPECT().
+		DeleteMessageBatchWithContext(gomock.Any(), &sqs.DeleteMessageBatchInput{
+			QueueUrl: low,
+			Entries: []*sqs.DeleteMessageBatchRequestEntry{{
+				Id:            aws.String("0"),
+				ReceiptHandle: aws.String("handle"),
+			}},
+		}).
+		Return(&sqs.DeleteMessageBatchOutput{}, nil)
+
+	dispatch := mustNew(t, Options{
+		SQS: sqsapi,
+		Receive: ReceiveOptions{
+			RecieveMessageInput: &sqs.ReceiveMessageInput{},
+			Queues:              []Queue{{URL: high}, {URL: low}},
+		},
+		Delete: DeleteOptions{Interval: time.Millisecond},
+	})
+	dispatch.Start(ctx)
+
+	message := <-dispatch.Receives()
+	assert.Equal(t, low, dispatch.MessageQueueURL(message))
+	assert.NoError(t, dispatch.Ack(ctx, message))
+	assert.Equal(t, high, dispatch.MessageQueueURL(message))
+}
+
+func TestReceiveQueuesOrder(t *testing.T) {
+	a, b, c := aws.String("a"), aws.String("b"), aws.String("c")
+
+	strict := ReceiveOptions{Queues: []Queue{{URL: a}, {URL: b, Weight: 10}, {URL: c}}}
+	assert.Equal(t, []*string{a, b, c}, strict.order())
+
+	weighted := ReceiveOptions{
+		Queues:   []Queue{{URL: a, Weight: 3}, {URL: b}},
+		Priority: PriorityWeighted,
+	}
+
+	first := 0
+	for i := 0; i < 1000; i++ {
+		order := weighted.order()
+		assert.ElementsMatch(t, []*string{a, b}, order)
+
+		if order[0] == a {
+			first++
+		}
+	}
+
+	assert.InDelta(t, 750, first, 100)
+}
@@ -0,0 +1,98 @@
+package sqsch
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// ReleaseOptions configures returning of messages to the queue
+type ReleaseOptions struct {
+	// Backoff computes the delay for releases that do not specify one
+	Backoff BackoffPolicy
+}
+
+// Release is a request to return a received message to the queue without deleting it.
+// The message becomes visible to receivers again after Delay. If Delay is zero, it is
+// computed by Options.Release.Backoff, or the message is visible again immediately if
+// no policy is configured. Delays are capped at MaxVisibilityTimeout.
+type Release struct {
+	Message *sqs.Message
+	Delay   time.Duration
+}
+
+// Release processes messages received on the release channel until Shutdown stops accepting
+// input or the supplied context is canceled. Each release stops heartbeats for its message and sets
+// the message's visibility timeout to the requested delay. Messages from the same FIFO message
+// group that are waiting to be delivered after it are released too, preserving their order.
+// Releases are batched together with heartbeats and sent via the SQS ChangeMessageVisibilityBatch API.
+func (d *Dispatch) Release(ctx context.Context) {
+	d.changers.Add(1)
+
+	go func() {
+		defer d.changers.Done()
+
+		// messages waiting behind a released message in its FIFO group are released with it
+		accept := func(release *Release) bool {
+			releases := []*Release{release}
+			for _, message := range d.groups.release(release.Message) {
+				releases = append(releases, &Release{Message: message})
+			}
+
+			for _, release := range releases {
+				d.leases.remove(release.Message)
+				d.claims.remove(release.Message)
+				d.inflight.remove(release.Message)
+				d.endProcessing(release.Message, nil)
+
+				select {
+				case d.changes <- &visibilityChange{message: release.Message, timeout: d.releaseDelay(release), release: true}:
+				case <-ctx.Done():
+					return false
+				}
+			}
+
+			return true
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case release := <-d.releases:
+				if !accept(release) {
+					return
+				}
+			case <-d.stopping:
+				for {
+					select {
+					case release := <-d.releases:
+						if !accept(release) {
+							return
+						}
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+func (d *Dispatch) releaseDelay(release *Release) time.Duration {
+	delay := release.Delay
+
+	if delay == 0 && d.Options.Release.Backoff != nil {
+		delay = d.Options.Release.Backoff(ReceiveCount(release.Message))
+	}
+
+	switch {
+	case delay < 0:
+		return 0
+	case delay > MaxVisibilityTimeout:
+		return MaxVisibilityTimeout
+	default:
+		return delay
+	}
+}
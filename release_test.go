@@ -0,0 +1,93 @@
+package sqsch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelease(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl: aws.String("http://foo.bar"),
+	}
+
+	blockReceives(sqsapi)
+
+	sqsapi.
+		EXPECT().
+		ChangeMessageVisibilityBatchWithContext(gomock.Any(), &sqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String("http://foo.bar"),
+			Entries: []*sqs.ChangeMessageVisibilityBatchRequestEntry{
+				{
+					Id:                aws.String("0"),
+					ReceiptHandle:     aws.String("now"),
+					VisibilityTimeout: aws.Int64(0),
+				},
+				{
+					Id:                aws.String("1"),
+					ReceiptHandle:     aws.String("later"),
+					VisibilityTimeout: aws.Int64(60),
+				},
+			},
+		}).
+		Return(&sqs.ChangeMessageVisibilityBatchOutput{}, nil)
+
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: input},
+		Delete:  DeleteOptions{Interval: time.Hour},
+	})
+
+	dispatch.Start(ctx)
+	dispatch.Releases() <- &Release{Message: &sqs.Message{ReceiptHandle: aws.String("now")}}
+	dispatch.Releases() <- &Release{Message: &sqs.Message{ReceiptHandle: aws.String("later")}, Delay: time.Minute}
+
+	assert.NoError(t, dispatch.Shutdown(ctx))
+}
+
+func TestReleaseFailure(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl: aws.String("http://foo.bar"),
+	}
+
+	blockReceives(sqsapi)
+
+	sqsapi.
+		EXPECT().
+		ChangeMessageVisibilityBatchWithContext(gomock.Any(), gomock.Any()).
+		Return(&sqs.ChangeMessageVisibilityBatchOutput{
+			Failed: []*sqs.BatchResultErrorEntry{
+				{
+					Id:      aws.String("1"),
+					Code:    aws.String("ReceiptHandleIsInvalid"),
+					Message: aws.String("invalid handle"),
+				},
+			},
+		}, nil)
+
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: input},
+		Delete:  DeleteOptions{Interval: time.Hour},
+	})
+
+	dispatch.Start(ctx)
+	dispatch.Releases() <- &Release{Message: &sqs.Message{ReceiptHandle: aws.String("valid")}}
+	dispatch.Releases() <- &Release{Message: &sqs.Message{ReceiptHandle: aws.String("invalid")}}
+
+	go dispatch.Shutdown(ctx)
+
+	err := <-dispatch.Errors()
+	assert.EqualError(t, err, "SQS batch change visibility error: invalid handle (ReceiptHandleIsInvalid)")
+	assert.Equal(t, "invalid", err.(*BatchChangeVisibilityError).ReceiptHandle)
+}
@@ -0,0 +1,326 @@
+package sqsch
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"github.com/bendrucker/sqs-receive-channel/pkg/batch"
+)
+
+// MaxPayloadSize is the largest total size in bytes of the bodies and attributes of the
+// messages in a SendMessageBatch request, and of a single message
+// https://docs.aws.amazon.com/AWSSimpleQueueService/latest/APIReference/API_SendMessageBatch.html
+const MaxPayloadSize = 256 * 1024
+
+// SendOptions configures batching of messages sent to the send channel
+type SendOptions struct {
+	// Interval is the longest a message waits to be batched with others (default: 1s)
+	Interval time.Duration
+	// Concurrency is the number of concurrent SendMessageBatch requests (default: 1)
+	Concurrency int
+	// MaxAttempts limits how many times an entry is sent when SQS fails it for a reason that is
+	// not the sender's fault (default: 3)
+	MaxAttempts int
+	// Backoff returns how long to wait before retrying failed entries, given the number of
+	// attempts made so far (default: ExponentialBackoff(100ms, 5s))
+	Backoff BackoffPolicy
+
+	// ResultFunc is called with the result of every send
+	ResultFunc SendResultFunc
+}
+
+// Defaults sets default values
+func (so *SendOptions) Defaults() {
+	if so.Interval == 0 {
+		so.Interval = time.Duration(1) * time.Second
+	}
+
+	if so.Concurrency == 0 {
+		so.Concurrency = 1
+	}
+
+	if so.MaxAttempts == 0 {
+		so.MaxAttempts = 3
+	}
+
+	if so.Backoff == nil {
+		so.Backoff = ExponentialBackoff(100*time.Millisecond, 5*time.Second)
+	}
+}
+
+// BatchSendError represents an error returned from SQS in response to a SendMessageBatch request
+type BatchSendError struct {
+	Code        string
+	Message     string
+	SenderFault bool
+}
+
+func (err *BatchSendError) Error() string {
+	return fmt.Sprintf("SQS batch send error: %s (%s)", err.Message, err.Code)
+}
+
+// PayloadSizeError represents a message that is larger than MaxPayloadSize
+type PayloadSizeError struct {
+	Size int
+}
+
+func (err *PayloadSizeError) Error() string {
+	return fmt.Sprintf("message size %d exceeds the maximum of %d bytes", err.Size, MaxPayloadSize)
+}
+
+// SendResult reports the outcome of sending a message.
+// If Err is nil, MessageId (and SequenceNumber for FIFO queues) are set by SQS.
+// Otherwise Err is a *BatchSendError, a *PayloadSizeError, or the error returned
+// by the SendMessageBatch request.
+type SendResult struct {
+	Input          *sqs.SendMessageInput
+	MessageId      *string
+	SequenceNumber *string
+	Err            error
+}
+
+// SendResultFunc is called with the result of every message sent to the send channel.
+// It may be called concurrently from multiple goroutines.
+type SendResultFunc func(*SendResult)
+
+// Sends returns the channel that accepts messages to be sent. Messages are sent to
+// their QueueUrl, or to Dispatch.QueueURL if it is not set. A Dispatch always receives, so
+// it requires a receive queue even if it is only used to send.
+func (d *Dispatch) Sends() chan<- *sqs.SendMessageInput {
+	return d.sends
+}
+
+// Send processes messages received on the send channel until Shutdown stops accepting
+// input or the supplied context is canceled. It batches messages according to Send.Interval,
+// MaxBatchSize, and MaxPayloadSize and calls the SQS SendMessageBatch API. Entries that
+// fail for reasons other than the sender's fault are retried up to Send.MaxAttempts times,
+// waiting according to Send.Backoff between attempts. Only failed entries are retried: if
+// the whole request fails after the SQS client's own retries, every message in the batch is
+// reported with its error.
+// Each failure is sent to the errors channel, and Send.ResultFunc is called with the result
+// of every message.
+func (d *Dispatch) Send(ctx context.Context) {
+	input := make(chan interface{})
+	go func() {
+		defer close(input)
+
+		accept := func(message *sqs.SendMessageInput) bool {
+			if d.Options.Tracing.Enabled() && !d.injected(message) {
+				d.Inject(ctx, message)
+			}
+
+			if size := payloadSize(message); size > MaxPayloadSize {
+				d.sent(ctx, &SendResult{Input: message, Err: &PayloadSizeError{Size: size}})
+				return true
+			}
+
+			select {
+			case input <- message:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for {
+			select {
+			case message := <-d.sends:
+				if !accept(message) {
+					return
+				}
+			case <-d.stopping:
+				for {
+					select {
+					case message := <-d.sends:
+						if !accept(message) {
+							return
+						}
+					default:
+						return
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	batches := batch.NewLimited(input, MaxBatchSize, d.Options.Send.Interval, MaxPayloadSize, func(message interface{}) int {
+		return payloadSize(message.(*sqs.SendMessageInput))
+	})
+
+	for i := 0; i < d.Options.Send.Concurrency; i++ {
+		d.sending.Add(1)
+
+		go func() {
+			defer d.sending.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case b, ok := <-batches:
+					if !ok {
+						return
+					}
+
+					messages := make([]*sqs.SendMessageInput, len(b))
+					for j, message := range b {
+						messages[j] = message.(*sqs.SendMessageInput)
+					}
+
+					d.sendBatch(ctx, messages)
+				}
+			}
+		}()
+	}
+}
+
+func (d *Dispatch) sendBatch(ctx context.Context, messages []*sqs.SendMessageInput) {
+	var urls []*string
+	indexes := make(map[string][]int)
+
+	for i, message := range messages {
+		url := message.QueueUrl
+		if url == nil {
+			url = d.QueueURL()
+		}
+
+		key := aws.StringValue(url)
+		if _, ok := indexes[key]; !ok {
+			urls = append(urls, url)
+		}
+
+		indexes[key] = append(indexes[key], i)
+	}
+
+	for _, url := range urls {
+		d.sendQueueBatch(ctx, url, messages, indexes[aws.StringValue(url)])
+	}
+}
+
+// sendQueueBatch sends the messages at indexes to the queue at url, retrying failed entries
+func (d *Dispatch) sendQueueBatch(ctx context.Context, url *string, messages []*sqs.SendMessageInput, indexes []int) {
+	for attempt := 1; len(indexes) > 0; attempt++ {
+		if attempt > 1 {
+			if err := d.sendBackoff(ctx, attempt-1); err != nil {
+				for _, i := range indexes {
+					d.sent(ctx, &SendResult{Input: messages[i], Err: err})
+				}
+
+				return
+			}
+		}
+
+		entries := make([]*sqs.SendMessageBatchRequestEntry, len(indexes))
+
+		for j, i := range indexes {
+			message := messages[i]
+			entries[j] = &sqs.SendMessageBatchRequestEntry{
+				Id:                     aws.String(strconv.Itoa(i)),
+				MessageBody:            message.MessageBody,
+				MessageAttributes:      message.MessageAttributes,
+				DelaySeconds:           message.DelaySeconds,
+				MessageGroupId:         message.MessageGroupId,
+				MessageDeduplicationId: message.MessageDeduplicationId,
+			}
+		}
+
+		start := time.Now()
+		output, err := d.Options.SQS.SendMessageBatchWithContext(ctx, &sqs.SendMessageBatchInput{
+			Entries:  entries,
+			QueueUrl: url,
+		})
+		d.observe("SendMessageBatch", start, err)
+
+		if err != nil {
+			d.log(ctx, LogError, "send batch failed", url, LogKeyCount, len(entries), LogKeyError, err)
+
+			for _, i := range indexes {
+				d.sent(ctx, &SendResult{Input: messages[i], Err: err})
+			}
+
+			return
+		}
+
+		for _, success := range output.Successful {
+			i, err := strconv.Atoi(aws.StringValue(success.Id))
+			if err != nil || i < 0 || i >= len(messages) {
+				continue
+			}
+
+			d.sent(ctx, &SendResult{
+				Input:          messages[i],
+				MessageId:      success.MessageId,
+				SequenceNumber: success.SequenceNumber,
+			})
+		}
+
+		var retries []int
+
+		for _, failure := range output.Failed {
+			i, err := strconv.Atoi(aws.StringValue(failure.Id))
+			if err != nil || i < 0 || i >= len(messages) {
+				continue
+			}
+
+			if !aws.BoolValue(failure.SenderFault) && attempt < d.Options.Send.MaxAttempts {
+				retries = append(retries, i)
+				continue
+			}
+
+			d.log(ctx, LogWarn, "send failed", url,
+				LogKeyCode, aws.StringValue(failure.Code),
+				LogKeyError, aws.StringValue(failure.Message),
+			)
+			d.sent(ctx, &SendResult{Input: messages[i], Err: &BatchSendError{
+				Code:        aws.StringValue(failure.Code),
+				Message:     aws.StringValue(failure.Message),
+				SenderFault: aws.BoolValue(failure.SenderFault),
+			}})
+		}
+
+		indexes = retries
+	}
+}
+
+// sendBackoff waits before the next attempt to send failed entries. It returns an error if
+// ctx is done first.
+func (d *Dispatch) sendBackoff(ctx context.Context, attempts int) error {
+	timer := time.NewTimer(d.Options.Send.Backoff(attempts))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sent reports the result of sending a message
+func (d *Dispatch) sent(ctx context.Context, result *SendResult) {
+	if result.Err != nil {
+		d.error(ctx, result.Err)
+	}
+
+	if d.Options.Send.ResultFunc != nil {
+		d.Options.Send.ResultFunc(result)
+	}
+}
+
+// payloadSize returns the size of a message as counted towards MaxPayloadSize
+func payloadSize(message *sqs.SendMessageInput) int {
+	size := len(aws.StringValue(message.MessageBody))
+
+	for name, value := range message.MessageAttributes {
+		size += len(name) + len(aws.StringValue(value.DataType)) + len(aws.StringValue(value.StringValue)) + len(value.BinaryValue)
+	}
+
+	return size
+}
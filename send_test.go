@@ -0,0 +1,122 @@
+package sqsch
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSend(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	blockReceives(sqsapi)
+
+	gomock.InOrder(
+		sqsapi.
+			EXPECT().
+			SendMessageBatchWithContext(gomock.Any(), &sqs.SendMessageBatchInput{
+				QueueUrl: aws.String("http://foo.bar"),
+				Entries: []*sqs.SendMessageBatchRequestEntry{
+					{Id: aws.String("0"), MessageBody: aws.String("a")},
+					{Id: aws.String("1"), MessageBody: aws.String("b")},
+					{Id: aws.String("2"), MessageBody: aws.String("c")},
+				},
+			}).
+			Return(&sqs.SendMessageBatchOutput{
+				Successful: []*sqs.SendMessageBatchResultEntry{{Id: aws.String("0"), MessageId: aws.String("id-a")}},
+				Failed: []*sqs.BatchResultErrorEntry{
+					{Id: aws.String("1"), Code: aws.String("InternalError"), Message: aws.String("try again"), SenderFault: aws.Bool(false)},
+					{Id: aws.String("2"), Code: aws.String("InvalidMessageContents"), Message: aws.String("invalid"), SenderFault: aws.Bool(true)},
+				},
+			}, nil),
+		sqsapi.
+			EXPECT().
+			SendMessageBatchWithContext(gomock.Any(), &sqs.SendMessageBatchInput{
+				QueueUrl: aws.String("http://foo.bar"),
+				Entries: []*sqs.SendMessageBatchRequestEntry{
+					{Id: aws.String("1"), MessageBody: aws.String("b")},
+				},
+			}).
+			Return(&sqs.SendMessageBatchOutput{
+				Successful: []*sqs.SendMessageBatchResultEntry{{Id: aws.String("1"), MessageId: aws.String("id-b")}},
+			}, nil),
+	)
+
+	var mutex sync.Mutex
+	results := make(map[string]*SendResult)
+	var backoffs []int
+
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: aws.String("http://foo.bar")}},
+		Send: SendOptions{
+			Interval: time.Hour,
+			Backoff: func(attempts int) time.Duration {
+				backoffs = append(backoffs, attempts)
+				return time.Millisecond
+			},
+			ResultFunc: func(result *SendResult) {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				results[aws.StringValue(result.Input.MessageBody)] = result
+			},
+		},
+	})
+	dispatch.Start(ctx)
+
+	for _, body := range []string{"a", "b", "c"} {
+		dispatch.Sends() <- &sqs.SendMessageInput{MessageBody: aws.String(body)}
+	}
+
+	assert.NoError(t, dispatch.Shutdown(ctx))
+
+	assert.Equal(t, "id-a", aws.StringValue(results["a"].MessageId))
+	assert.Equal(t, "id-b", aws.StringValue(results["b"].MessageId))
+	assert.EqualError(t, results["c"].Err, "SQS batch send error: invalid (InvalidMessageContents)")
+	assert.EqualError(t, <-dispatch.Errors(), "SQS batch send error: invalid (InvalidMessageContents)")
+	assert.Equal(t, []int{1}, backoffs)
+}
+
+func TestSendPayloadSize(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	body := strings.Repeat("x", MaxPayloadSize/2)
+
+	sqsapi.
+		EXPECT().
+		SendMessageBatchWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, input *sqs.SendMessageBatchInput) (*sqs.SendMessageBatchOutput, error) {
+			assert.Len(t, input.Entries, 1)
+			return &sqs.SendMessageBatchOutput{
+				Successful: []*sqs.SendMessageBatchResultEntry{{Id: input.Entries[0].Id}},
+			}, nil
+		}).
+		Times(2)
+
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: aws.String("http://foo.bar")}},
+		Send:    SendOptions{Interval: time.Hour},
+	})
+	dispatch.Send(ctx)
+
+	dispatch.Sends() <- &sqs.SendMessageInput{MessageBody: aws.String(body)}
+	dispatch.Sends() <- &sqs.SendMessageInput{MessageBody: aws.String(body), MessageAttributes: map[string]*sqs.MessageAttributeValue{
+		"key": {DataType: aws.String("String"), StringValue: aws.String("value")},
+	}}
+	dispatch.Sends() <- &sqs.SendMessageInput{MessageBody: aws.String(body + body + "x")}
+	close(dispatch.stopping)
+
+	assert.IsType(t, &PayloadSizeError{}, <-dispatch.Errors())
+	dispatch.sending.Wait()
+}
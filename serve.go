@@ -0,0 +1,206 @@
+package sqsch
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Handler processes a single message received by Serve
+type Handler interface {
+	HandleMessage(ctx context.Context, message *sqs.Message) error
+}
+
+// HandlerFunc is an adapter that allows an ordinary function to be used as a Handler
+type HandlerFunc func(ctx context.Context, message *sqs.Message) error
+
+// HandleMessage calls f(ctx, message)
+func (f HandlerFunc) HandleMessage(ctx context.Context, message *sqs.Message) error {
+	return f(ctx, message)
+}
+
+// ServeOptions configures the worker pool run by Serve
+type ServeOptions struct {
+	// Concurrency is the number of messages that are handled concurrently (default: 1)
+	Concurrency int
+	// ErrorFunc receives receive, delete, and handler errors sent to the error channel.
+	// Errors are discarded if nil.
+	ErrorFunc ErrorFunc
+}
+
+// Defaults sets default values
+func (so *ServeOptions) Defaults() {
+	if so.Concurrency == 0 {
+		so.Concurrency = 1
+	}
+}
+
+// HandlerError represents an error returned by a Handler. The message is released.
+type HandlerError struct {
+	Message *sqs.Message
+	Err     error
+}
+
+func (err *HandlerError) Error() string {
+	return fmt.Sprintf("handler error: %s", err.Err)
+}
+
+// PanicError represents a panic recovered from a Handler
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", err.Value)
+}
+
+// Serve receives messages and calls handler for each one using Serve.Concurrency workers.
+// Messages are only received when a worker is idle. When the handler returns nil, the
+// message is deleted. When it returns an error or panics, the message is released
+// (using Release.Backoff if configured) and a *HandlerError is reported like any other
+// error. Serve reads the error channel and passes each error to Serve.ErrorFunc, so
+// Errors.Block never stalls workers. Errors.Handler takes precedence if it is set.
+// If tracing is enabled, the ctx passed to handler carries the message's consumer span.
+// Serve blocks until ctx is canceled, then stops receiving, waits for running handlers,
+// and flushes pending deletes and releases within Options.ShutdownTimeout. It returns an
+// error immediately if New does.
+func Serve(ctx context.Context, options Options, handler Handler) error {
+	options.Serve.Defaults()
+	workers := make(chan Worker, options.Serve.Concurrency)
+	options.Receive.Workers = workers
+
+	dispatch, err := New(ctx, options)
+	if err != nil {
+		return err
+	}
+
+	dispatch.Start(detach(ctx))
+
+	handlerCtx, cancelHandlers := context.WithCancel(detach(ctx))
+	defer cancelHandlers()
+
+	errors := &sync.WaitGroup{}
+	errors.Add(1)
+
+	go func() {
+		defer errors.Done()
+
+		for err := range dispatch.Errors() {
+			options.Serve.onError(err)
+		}
+	}()
+
+	handlers := &sync.WaitGroup{}
+
+	for i := 0; i < options.Serve.Concurrency; i++ {
+		handlers.Add(1)
+
+		go func() {
+			defer handlers.Done()
+
+			work := make(chan *sqs.Message)
+			for {
+				workers <- work
+
+				select {
+				case message := <-work:
+					dispatch.handle(handlerCtx, handler, message)
+				// nothing is sent to the receive channel when workers are used,
+				// so it is only ready once it is closed after receiving stops
+				case <-dispatch.Receives():
+					return
+				}
+			}
+		}()
+	}
+
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(detach(ctx), dispatch.Options.ShutdownTimeout)
+	defer cancel()
+
+	dispatch.stopReceive()
+
+	done := make(chan struct{})
+	go func() {
+		handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		cancelHandlers()
+		<-done
+	}
+
+	err = dispatch.Shutdown(shutdownCtx)
+	errors.Wait()
+
+	return err
+}
+
+// handle calls handler for a message and then deletes or releases it
+func (d *Dispatch) handle(ctx context.Context, handler Handler, message *sqs.Message) {
+	ctx = d.MessageContext(ctx, message)
+
+	if err := call(ctx, handler, message); err != nil {
+		span := trace.SpanFromContext(ctx)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		d.error(ctx, &HandlerError{Message: message, Err: err})
+		d.releases <- &Release{Message: message}
+		return
+	}
+
+	d.deletes <- message
+}
+
+func call(ctx context.Context, handler Handler, message *sqs.Message) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+
+	return handler.HandleMessage(ctx, message)
+}
+
+func (so *ServeOptions) onError(err error) {
+	if so.ErrorFunc != nil {
+		so.ErrorFunc(err)
+	}
+}
+
+// detach returns a context that carries the values of ctx but is never canceled
+func detach(ctx context.Context) context.Context {
+	return detached{ctx}
+}
+
+type detached struct {
+	parent context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (detached) Err() error {
+	return nil
+}
+
+func (d detached) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
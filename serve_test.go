@@ -0,0 +1,199 @@
+package sqsch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServe(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl: aws.String("http://foo.bar"),
+	}
+
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), gomock.Any()).
+		Return(&sqs.ReceiveMessageOutput{
+			Messages: []*sqs.Message{
+				{Body: aws.String("ok"), ReceiptHandle: aws.String("ok")},
+				{Body: aws.String("error"), ReceiptHandle: aws.String("error")},
+				{Body: aws.String("panic"), ReceiptHandle: aws.String("panic")},
+			},
+		}, nil)
+
+	blockReceives(sqsapi)
+
+	sqsapi.
+		EXPECT().
+		DeleteMessageBatchWithContext(gomock.Any(), &sqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String("http://foo.bar"),
+			Entries: []*sqs.DeleteMessageBatchRequestEntry{
+				{
+					Id:            aws.String("0"),
+					ReceiptHandle: aws.String("ok"),
+				},
+			},
+		}).
+		Return(&sqs.DeleteMessageBatchOutput{}, nil)
+
+	sqsapi.
+		EXPECT().
+		ChangeMessageVisibilityBatchWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, input *sqs.ChangeMessageVisibilityBatchInput) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+			assert.Len(t, input.Entries, 2)
+			return &sqs.ChangeMessageVisibilityBatchOutput{}, nil
+		})
+
+	var (
+		mutex  sync.Mutex
+		errs   []error
+		called sync.WaitGroup
+	)
+
+	called.Add(3)
+
+	go func() {
+		called.Wait()
+		cancel()
+	}()
+
+	err := Serve(ctx, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: input},
+		Delete:  DeleteOptions{Interval: time.Hour},
+		Serve:   ServeOptions{Concurrency: 3},
+		Errors: ErrorOptions{
+			Handler: func(err error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				errs = append(errs, err)
+			},
+		},
+	}, HandlerFunc(func(ctx context.Context, message *sqs.Message) error {
+		defer called.Done()
+
+		switch aws.StringValue(message.Body) {
+		case "error":
+			return errors.New("oops")
+		case "panic":
+			panic("boom")
+		default:
+			return nil
+		}
+	}))
+
+	assert.NoError(t, err)
+	assert.Len(t, errs, 2)
+
+	for _, err := range errs {
+		herr := err.(*HandlerError)
+
+		switch aws.StringValue(herr.Message.Body) {
+		case "error":
+			assert.EqualError(t, herr, "handler error: oops")
+		case "panic":
+			assert.EqualError(t, herr, "handler error: panic: boom")
+			assert.IsType(t, &PanicError{}, herr.Err)
+		default:
+			t.Errorf("unexpected error: %s", herr)
+		}
+	}
+}
+
+func TestServeErrorsBlock(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), gomock.Any()).
+		Return(&sqs.ReceiveMessageOutput{
+			Messages: []*sqs.Message{
+				{Body: aws.String("a"), ReceiptHandle: aws.String("a")},
+				{Body: aws.String("b"), ReceiptHandle: aws.String("b")},
+			},
+		}, nil)
+
+	blockReceives(sqsapi)
+	expectReleases(sqsapi)
+
+	errs := make(chan error, 2)
+	go func() {
+		<-errs
+		<-errs
+		cancel()
+	}()
+
+	err := Serve(ctx, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: aws.String("http://foo.bar")}},
+		Serve: ServeOptions{
+			ErrorFunc: func(err error) {
+				errs <- err
+			},
+		},
+		Errors: ErrorOptions{Block: true},
+	}, HandlerFunc(func(ctx context.Context, message *sqs.Message) error {
+		return errors.New("oops")
+	}))
+
+	assert.NoError(t, err)
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), gomock.Any()).
+		Return(&sqs.ReceiveMessageOutput{
+			Messages: []*sqs.Message{{Body: aws.String("a"), ReceiptHandle: aws.String("a")}},
+		}, nil)
+
+	blockReceives(sqsapi)
+	expectReleases(sqsapi)
+
+	canceled := make(chan error, 1)
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+
+		_ = Serve(ctx, Options{
+			SQS:             sqsapi,
+			Receive:         ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: aws.String("http://foo.bar")}},
+			ShutdownTimeout: 50 * time.Millisecond,
+		}, HandlerFunc(func(ctx context.Context, message *sqs.Message) error {
+			cancel()
+			<-ctx.Done()
+			canceled <- ctx.Err()
+			return ctx.Err()
+		}))
+	}()
+
+	select {
+	case err := <-canceled:
+		assert.Equal(t, context.Canceled, err, "handlers are canceled after Options.ShutdownTimeout")
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler was not canceled")
+	}
+
+	<-served
+}
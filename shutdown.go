@@ -0,0 +1,166 @@
+package sqsch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// ErrShutdown is returned by Ack once the Dispatch no longer accepts deletes
+var ErrShutdown = errors.New("sqsch: dispatch is shut down")
+
+// Shutdown gracefully stops a started Dispatch. It stops receiving, releases messages
+// that are buffered in the receive channel, and waits for every message that has already
+// been delivered to be deleted or released. If ctx has a deadline, it waits for at most half
+// of the remaining time, and messages that are still unsettled are abandoned to become
+// visible once their timeout expires. It then stops accepting deletes, releases, and
+// sends, flushes everything pending, and returns once every goroutine has exited. The
+// receive and error channels are closed so consumers can range over them.
+// The delete, release, and send channels are never closed. Once Done is closed, messages
+// sent to them are no longer read. If ctx is done before pending deletes are flushed, the
+// requests in flight are aborted and ctx.Err() is returned. Shutdown may be called more
+// than once.
+func (d *Dispatch) Shutdown(ctx context.Context) error {
+	d.shutdown.Do(func() {
+		d.log(ctx, LogInfo, "shutdown started", d.QueueURL())
+
+		settle, cancel := settleContext(ctx)
+		go func() {
+			defer cancel()
+			d.stop(settle)
+		}()
+	})
+
+	select {
+	case <-d.stopped:
+		d.log(ctx, LogInfo, "shutdown complete", d.QueueURL())
+		return nil
+	case <-ctx.Done():
+		d.abortDeletes()
+		<-d.stopped
+		d.log(context.Background(), LogWarn, "shutdown timed out: pending deletes abandoned", d.QueueURL(), LogKeyError, ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// Done returns a channel that is closed once Shutdown stops accepting deletes, releases,
+// and sends
+func (d *Dispatch) Done() <-chan struct{} {
+	return d.stopping
+}
+
+// settleContext returns a context that is done once half of the time until the deadline of
+// ctx has passed, leaving the rest to flush pending deletes and releases
+func settleContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithDeadline(ctx, time.Now().Add(time.Until(deadline)/2))
+}
+
+// stop receiving, wait until delivered messages are settled or settle is done, and stop
+// accepting input
+func (d *Dispatch) stop(settle context.Context) {
+	d.stopReceive()
+	d.receiving.Wait()
+
+	// the receive channel is closed once receiving stops
+	for message := range d.receives {
+		d.requeue(message)
+	}
+
+	d.consumers.Wait()
+
+	select {
+	case <-d.inflight.idle():
+	case <-d.processDone:
+	case <-settle.Done():
+		d.log(settle, LogWarn, "shutdown: unsettled messages abandoned", d.QueueURL(), LogKeyCount, d.inflight.len())
+	}
+
+	close(d.stopping)
+}
+
+// requeue releases a message that was received but never processed. If processing has
+// been aborted, the message is abandoned and becomes visible once its timeout expires.
+func (d *Dispatch) requeue(message *sqs.Message) {
+	select {
+	case d.releases <- &Release{Message: message}:
+	case <-d.processDone:
+		d.forget(message)
+	}
+}
+
+// forget discards everything tracked for a message that will not be deleted or released
+func (d *Dispatch) forget(message *sqs.Message) {
+	d.leases.remove(message)
+	d.claims.remove(message)
+	d.origins.remove(message)
+	d.groups.done(message)
+	d.inflight.remove(message)
+	d.endProcessing(message, nil)
+}
+
+// inflight tracks messages that have been received but not yet deleted or released
+type inflight struct {
+	mutex    sync.Mutex
+	messages map[string]struct{}
+	// empty is closed while no messages are in flight
+	empty chan struct{}
+}
+
+func newInflight() *inflight {
+	empty := make(chan struct{})
+	close(empty)
+
+	return &inflight{messages: make(map[string]struct{}), empty: empty}
+}
+
+func (i *inflight) add(message *sqs.Message) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if len(i.messages) == 0 {
+		i.empty = make(chan struct{})
+	}
+
+	i.messages[aws.StringValue(message.ReceiptHandle)] = struct{}{}
+}
+
+func (i *inflight) remove(message *sqs.Message) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	handle := aws.StringValue(message.ReceiptHandle)
+	if _, ok := i.messages[handle]; !ok {
+		return
+	}
+
+	delete(i.messages, handle)
+
+	if len(i.messages) == 0 {
+		close(i.empty)
+	}
+}
+
+// len returns the number of messages in flight
+func (i *inflight) len() int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return len(i.messages)
+}
+
+// idle returns a channel that is closed once no messages are in flight
+func (i *inflight) idle() <-chan struct{} {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return i.empty
+}
@@ -0,0 +1,298 @@
+package sqsch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/bendrucker/sqs-receive-channel/fake"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdown(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl: aws.String("http://foo.bar"),
+	}
+
+	message := &sqs.Message{
+		Body:          aws.String("hello world"),
+		ReceiptHandle: aws.String("handle"),
+	}
+
+	blockReceives(sqsapi)
+
+	sqsapi.
+		EXPECT().
+		DeleteMessageBatchWithContext(gomock.Any(), &sqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String("http://foo.bar"),
+			Entries: []*sqs.DeleteMessageBatchRequestEntry{
+				{
+					Id:            aws.String("0"),
+					ReceiptHandle: aws.String("handle"),
+				},
+			},
+		}).
+		Return(&sqs.DeleteMessageBatchOutput{}, nil)
+
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: input},
+		Delete:  DeleteOptions{Interval: time.Hour},
+	})
+
+	dispatch.Start(ctx)
+	dispatch.Deletes() <- message
+
+	assert.NoError(t, dispatch.Shutdown(ctx))
+
+	_, ok := <-dispatch.Receives()
+	assert.False(t, ok)
+
+	_, ok = <-dispatch.Errors()
+	assert.False(t, ok)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl: aws.String("http://foo.bar"),
+	}
+
+	blockReceives(sqsapi)
+
+	started := make(chan struct{})
+	sqsapi.
+		EXPECT().
+		DeleteMessageBatchWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _ *sqs.DeleteMessageBatchInput) (*sqs.DeleteMessageBatchOutput, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: input},
+		Delete:  DeleteOptions{Interval: time.Hour},
+	})
+
+	dispatch.Start(ctx)
+	dispatch.Deletes() <- &sqs.Message{ReceiptHandle: aws.String("handle")}
+
+	shutdownCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	assert.Equal(t, context.Canceled, dispatch.Shutdown(shutdownCtx))
+}
+
+func TestShutdownLateDelete(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	blockReceives(sqsapi)
+
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: aws.String("http://foo.bar")}},
+	})
+
+	dispatch.Start(ctx)
+	assert.NoError(t, dispatch.Shutdown(ctx))
+
+	select {
+	case <-dispatch.Done():
+	default:
+		t.Fatal("accepting input after shutdown")
+	}
+
+	// does not panic, and is never deleted
+	dispatch.Deletes() <- &sqs.Message{ReceiptHandle: aws.String("handle")}
+
+	assert.Equal(t, ErrShutdown, dispatch.Ack(ctx, &sqs.Message{ReceiptHandle: aws.String("handle")}))
+}
+
+func TestShutdownReleasesBuffered(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	sqsapi.
+		EXPECT().
+		ReceiveMessageWithContext(gomock.Any(), gomock.Any()).
+		Return(&sqs.ReceiveMessageOutput{
+			Messages: []*sqs.Message{
+				{ReceiptHandle: aws.String("a")},
+				{ReceiptHandle: aws.String("b")},
+			},
+		}, nil)
+
+	blockReceives(sqsapi)
+
+	sqsapi.
+		EXPECT().
+		ChangeMessageVisibilityBatchWithContext(gomock.Any(), &sqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String("http://foo.bar"),
+			Entries: []*sqs.ChangeMessageVisibilityBatchRequestEntry{
+				{Id: aws.String("0"), ReceiptHandle: aws.String("a"), VisibilityTimeout: aws.Int64(0)},
+				{Id: aws.String("1"), ReceiptHandle: aws.String("b"), VisibilityTimeout: aws.Int64(0)},
+			},
+		}).
+		Return(&sqs.ChangeMessageVisibilityBatchOutput{}, nil)
+
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: aws.String("http://foo.bar")}, BufferSize: 2},
+		Delete:  DeleteOptions{Interval: time.Hour},
+	})
+
+	dispatch.Start(ctx)
+	assert.Eventually(t, func() bool { return len(dispatch.receives) == 2 }, time.Second, time.Millisecond)
+
+	assert.NoError(t, dispatch.Shutdown(ctx))
+}
+
+func TestShutdownCancel(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	blockReceives(sqsapi)
+
+	deleted := make(chan *sqs.DeleteMessageBatchInput, 1)
+	sqsapi.
+		EXPECT().
+		DeleteMessageBatchWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, input *sqs.DeleteMessageBatchInput) (*sqs.DeleteMessageBatchOutput, error) {
+			deleted <- input
+			return &sqs.DeleteMessageBatchOutput{}, nil
+		})
+
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: aws.String("http://foo.bar")}},
+		Delete:  DeleteOptions{Interval: time.Hour},
+	})
+
+	startCtx, cancel := context.WithCancel(ctx)
+	dispatch.Start(startCtx)
+	dispatch.Deletes() <- &sqs.Message{ReceiptHandle: aws.String("handle")}
+	cancel()
+
+	input := <-deleted
+	assert.Equal(t, "handle", aws.StringValue(input.Entries[0].ReceiptHandle), "flushes pending deletes")
+
+	_, ok := <-dispatch.Errors()
+	assert.False(t, ok)
+}
+
+func TestShutdownUnsettled(t *testing.T) {
+	sqsapi := fake.New(fake.Options{})
+	queue, err := sqsapi.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String("queue")})
+	assert.NoError(t, err)
+
+	for _, body := range []string{"deleted", "ignored"} {
+		_, err := sqsapi.SendMessage(&sqs.SendMessageInput{QueueUrl: queue.QueueUrl, MessageBody: aws.String(body)})
+		assert.NoError(t, err)
+	}
+
+	dispatch := mustNew(t, Options{
+		SQS:     sqsapi,
+		Receive: ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: queue.QueueUrl}, BufferSize: 2},
+		Delete:  DeleteOptions{Interval: 5 * time.Second},
+	})
+
+	dispatch.Start(context.Background())
+	dispatch.Deletes() <- <-dispatch.Receives()
+	<-dispatch.Receives()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assert.NoError(t, dispatch.Shutdown(ctx))
+
+	attributes, err := sqsapi.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       queue.QueueUrl,
+		AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible}),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", aws.StringValue(attributes.Attributes[sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible]), "deletes the settled message")
+}
+
+func TestSettleContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	settle, cancelSettle := settleContext(ctx)
+	defer cancelSettle()
+
+	deadline, ok := settle.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(30*time.Second), deadline, time.Second)
+
+	settle, cancelSettle = settleContext(context.Background())
+	defer cancelSettle()
+
+	_, ok = settle.Deadline()
+	assert.False(t, ok)
+}
+
+func TestInflight(t *testing.T) {
+	inflight := newInflight()
+	a, b := &sqs.Message{ReceiptHandle: aws.String("a")}, &sqs.Message{ReceiptHandle: aws.String("b")}
+
+	assert.True(t, closed(inflight.idle()))
+
+	inflight.add(a)
+	inflight.add(b)
+	idle := inflight.idle()
+
+	inflight.remove(a)
+	assert.False(t, closed(idle))
+
+	inflight.remove(b)
+	inflight.remove(b)
+	assert.True(t, closed(idle))
+}
+
+func TestRequeueAborted(t *testing.T) {
+	dispatch := newUnvalidated(Options{Heartbeat: HeartbeatOptions{Interval: time.Second}})
+	done := make(chan struct{})
+	close(done)
+	dispatch.processDone = done
+
+	message := &sqs.Message{ReceiptHandle: aws.String("handle")}
+	dispatch.inflight.add(message)
+	dispatch.track(message)
+	dispatch.claims.add(message, &PayloadPointer{Bucket: "bucket", Key: "key"})
+	dispatch.origins.add(message, aws.String("http://foo.bar"))
+
+	// fill the release buffer so that the release cannot be sent
+	for len(dispatch.releases) < cap(dispatch.releases) {
+		dispatch.releases <- &Release{}
+	}
+
+	dispatch.requeue(message)
+
+	assert.True(t, closed(dispatch.inflight.idle()))
+	assert.Empty(t, dispatch.leases.list())
+	assert.Nil(t, dispatch.claims.remove(message))
+	assert.Nil(t, dispatch.origins.get(message))
+}
+
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,170 @@
+package sqsch
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// SNSNotification is the envelope that SNS wraps around messages delivered to SQS
+// subscriptions that do not enable raw message delivery
+// https://docs.aws.amazon.com/sns/latest/dg/sns-message-and-json-formats.html
+type SNSNotification struct {
+	Type              string
+	MessageId         string
+	TopicArn          string
+	Subject           string
+	Message           string
+	Timestamp         time.Time
+	MessageAttributes map[string]SNSMessageAttribute
+
+	SignatureVersion string
+	Signature        string
+	SigningCertURL   string
+	UnsubscribeURL   string
+}
+
+// Message system attributes that Receive.UnwrapSNS sets from the notification envelope
+const (
+	SNSMessageId = "SNSMessageId"
+	SNSTopicArn  = "SNSTopicArn"
+	SNSSubject   = "SNSSubject"
+	SNSTimestamp = "SNSTimestamp"
+)
+
+// SNSMessageAttribute is a message attribute published to SNS
+type SNSMessageAttribute struct {
+	Type  string
+	Value string
+}
+
+// SNSEnvelopeError represents a message whose body is not a valid SNS notification
+type SNSEnvelopeError struct {
+	Message *sqs.Message
+	Err     error
+}
+
+func (err *SNSEnvelopeError) Error() string {
+	return fmt.Sprintf("invalid SNS envelope: %s", err.Err)
+}
+
+// Unwrap returns the underlying error
+func (err *SNSEnvelopeError) Unwrap() error {
+	return err.Err
+}
+
+// ParseSNSNotification parses the SNS notification envelope in the body of a message.
+// It returns a *SNSEnvelopeError if the body is not a valid notification.
+func ParseSNSNotification(message *sqs.Message) (*SNSNotification, error) {
+	notification := &SNSNotification{}
+
+	if err := json.Unmarshal([]byte(aws.StringValue(message.Body)), notification); err != nil {
+		return nil, &SNSEnvelopeError{Message: message, Err: err}
+	}
+
+	if notification.Type != "Notification" {
+		return nil, &SNSEnvelopeError{Message: message, Err: fmt.Errorf("unexpected type %q", notification.Type)}
+	}
+
+	if notification.TopicArn == "" {
+		return nil, &SNSEnvelopeError{Message: message, Err: errors.New("missing TopicArn")}
+	}
+
+	return notification, nil
+}
+
+// SNSDecoder returns a Decoder that unwraps SNS notification envelopes.
+// Use it with StartTyped or DecodeMessages to receive from queues subscribed to SNS topics
+// when the notification's metadata is needed. Otherwise, set Receive.UnwrapSNS to deliver
+// the inner message to any consumer or Decoder.
+func SNSDecoder() Decoder[*SNSNotification] {
+	return DecoderFunc[*SNSNotification](ParseSNSNotification)
+}
+
+// SNS returns the notification that a message was unwrapped from by Receive.UnwrapSNS. Its
+// Message is the body of the message, and its MessageAttributes are not set because they were
+// added to the message. It returns false if the message was not unwrapped.
+func SNS(message *sqs.Message) (*SNSNotification, bool) {
+	topic, ok := message.Attributes[SNSTopicArn]
+	if !ok {
+		return nil, false
+	}
+
+	timestamp, _ := time.Parse(time.RFC3339Nano, aws.StringValue(message.Attributes[SNSTimestamp]))
+
+	return &SNSNotification{
+		Type:      "Notification",
+		MessageId: aws.StringValue(message.Attributes[SNSMessageId]),
+		TopicArn:  aws.StringValue(topic),
+		Subject:   aws.StringValue(message.Attributes[SNSSubject]),
+		Message:   aws.StringValue(message.Body),
+		Timestamp: timestamp,
+	}, true
+}
+
+// unwrap replaces the body of a message with the message of its SNS notification if
+// Receive.UnwrapSNS is set
+func (d *Dispatch) unwrap(message *sqs.Message) error {
+	if !d.Options.Receive.UnwrapSNS {
+		return nil
+	}
+
+	notification, err := ParseSNSNotification(message)
+	if err != nil {
+		return err
+	}
+
+	message.Body = aws.String(notification.Message)
+
+	if message.Attributes == nil {
+		message.Attributes = make(map[string]*string)
+	}
+
+	message.Attributes[SNSMessageId] = aws.String(notification.MessageId)
+	message.Attributes[SNSTopicArn] = aws.String(notification.TopicArn)
+	message.Attributes[SNSSubject] = aws.String(notification.Subject)
+	message.Attributes[SNSTimestamp] = aws.String(notification.Timestamp.Format(time.RFC3339Nano))
+
+	for name, attribute := range notification.MessageAttributes {
+		if _, ok := message.MessageAttributes[name]; ok {
+			continue
+		}
+
+		value, err := attribute.value()
+		if err != nil {
+			return &SNSEnvelopeError{Message: message, Err: fmt.Errorf("message attribute %s: %w", name, err)}
+		}
+
+		if message.MessageAttributes == nil {
+			message.MessageAttributes = make(map[string]*sqs.MessageAttributeValue)
+		}
+
+		message.MessageAttributes[name] = value
+	}
+
+	return nil
+}
+
+// value converts an SNS message attribute to an SQS message attribute. SNS encodes binary
+// values with base64.
+func (attribute SNSMessageAttribute) value() (*sqs.MessageAttributeValue, error) {
+	value := &sqs.MessageAttributeValue{DataType: aws.String(attribute.Type)}
+
+	if attribute.Type != "Binary" {
+		value.StringValue = aws.String(attribute.Value)
+		return value, nil
+	}
+
+	binary, err := base64.StdEncoding.DecodeString(attribute.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	value.BinaryValue = binary
+	return value, nil
+}
@@ -0,0 +1,136 @@
+package sqsch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/bendrucker/sqs-receive-channel/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+const notification = `{
+  "Type": "Notification",
+  "MessageId": "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324",
+  "TopicArn": "arn:aws:sns:us-west-2:123456789012:MyTopic",
+  "Subject": "My First Message",
+  "Message": "Hello world!",
+  "Timestamp": "2012-05-02T00:54:06.655Z",
+  "SignatureVersion": "1",
+  "Signature": "EXAMPLEw6JRN",
+  "SigningCertURL": "https://sns.us-west-2.amazonaws.com/SimpleNotificationService.pem",
+  "UnsubscribeURL": "https://sns.us-west-2.amazonaws.com/?Action=Unsubscribe",
+  "MessageAttributes": {
+    "color": {"Type": "String", "Value": "blue"}
+  }
+}`
+
+func TestParseSNSNotification(t *testing.T) {
+	n, err := ParseSNSNotification(&sqs.Message{Body: aws.String(notification)})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello world!", n.Message)
+	assert.Equal(t, "arn:aws:sns:us-west-2:123456789012:MyTopic", n.TopicArn)
+	assert.Equal(t, "My First Message", n.Subject)
+	assert.Equal(t, time.Date(2012, 5, 2, 0, 54, 6, 655000000, time.UTC), n.Timestamp)
+	assert.Equal(t, SNSMessageAttribute{Type: "String", Value: "blue"}, n.MessageAttributes["color"])
+}
+
+func TestParseSNSNotificationInvalid(t *testing.T) {
+	cases := []struct {
+		body  string
+		error string
+	}{
+		{`hello`, "invalid SNS envelope: invalid character 'h' looking for beginning of value"},
+		{`{"Type": "SubscriptionConfirmation"}`, `invalid SNS envelope: unexpected type "SubscriptionConfirmation"`},
+		{`{"Type": "Notification"}`, "invalid SNS envelope: missing TopicArn"},
+	}
+
+	for _, c := range cases {
+		message := &sqs.Message{Body: aws.String(c.body)}
+		_, err := ParseSNSNotification(message)
+
+		assert.EqualError(t, err, c.error)
+		assert.Equal(t, message, err.(*SNSEnvelopeError).Message)
+	}
+}
+
+func TestSNSDecoder(t *testing.T) {
+	dispatch := newUnvalidated(Options{})
+	go func() {
+		dispatch.receives <- &sqs.Message{Body: aws.String(notification)}
+		dispatch.receives <- &sqs.Message{Body: aws.String("hello")}
+		close(dispatch.receives)
+	}()
+
+	received := DecodeMessages(context.TODO(), dispatch, SNSDecoder())
+	assert.Equal(t, "Hello world!", (<-received).Value.Message)
+
+	var envelopeErr *SNSEnvelopeError
+	assert.True(t, errors.As(<-dispatch.Errors(), &envelopeErr))
+}
+
+func TestUnwrapSNS(t *testing.T) {
+	dispatch := newUnvalidated(Options{Receive: ReceiveOptions{UnwrapSNS: true}})
+
+	message := &sqs.Message{Body: aws.String(notification)}
+	assert.NoError(t, dispatch.unwrap(message))
+	assert.Equal(t, "Hello world!", aws.StringValue(message.Body))
+	assert.Equal(t, map[string]*sqs.MessageAttributeValue{
+		"color": {DataType: aws.String("String"), StringValue: aws.String("blue")},
+	}, message.MessageAttributes)
+
+	n, ok := SNS(message)
+	assert.True(t, ok)
+	assert.Equal(t, &SNSNotification{
+		Type:      "Notification",
+		MessageId: "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324",
+		TopicArn:  "arn:aws:sns:us-west-2:123456789012:MyTopic",
+		Subject:   "My First Message",
+		Message:   "Hello world!",
+		Timestamp: time.Date(2012, 5, 2, 0, 54, 6, 655000000, time.UTC),
+	}, n)
+
+	invalid := &sqs.Message{Body: aws.String("hello")}
+	var envelopeErr *SNSEnvelopeError
+	assert.True(t, errors.As(dispatch.unwrap(invalid), &envelopeErr))
+	assert.Equal(t, "hello", aws.StringValue(invalid.Body))
+
+	disabled := newUnvalidated(Options{})
+	assert.NoError(t, disabled.unwrap(invalid))
+
+	_, ok = SNS(invalid)
+	assert.False(t, ok)
+}
+
+func TestUnwrapSNSDecode(t *testing.T) {
+	sqsapi := fake.New(fake.Options{})
+	queue, err := sqsapi.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String("queue")})
+	assert.NoError(t, err)
+
+	body := `{"Type":"Notification","TopicArn":"arn:aws:sns:us-east-1:000000000000:topic","Message":"{\"hello\":\"world\"}"}`
+	_, err = sqsapi.SendMessage(&sqs.SendMessageInput{QueueUrl: queue.QueueUrl, MessageBody: aws.String(body)})
+	assert.NoError(t, err)
+
+	dispatch, err := StartTyped[greeting](context.Background(), Options{
+		SQS: sqsapi,
+		Receive: ReceiveOptions{
+			RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: queue.QueueUrl},
+			UnwrapSNS:           true,
+		},
+	}, nil)
+	assert.NoError(t, err)
+
+	message := <-dispatch.Messages()
+	assert.Equal(t, greeting{Hello: "world"}, message.Value)
+
+	n, ok := SNS(message.Message)
+	assert.True(t, ok)
+	assert.Equal(t, "arn:aws:sns:us-east-1:000000000000:topic", n.TopicArn)
+
+	dispatch.Deletes() <- message.Message
+	assert.NoError(t, dispatch.Shutdown(context.Background()))
+}
@@ -0,0 +1,3 @@
+// Package tracing tests tracing with the OpenTelemetry SDK. It is a separate module so
+// that the root module only depends on the OpenTelemetry API.
+package tracing
@@ -0,0 +1,24 @@
+module github.com/bendrucker/sqs-receive-channel/test/tracing
+
+go 1.18
+
+require (
+	github.com/aws/aws-sdk-go v1.20.15
+	github.com/bendrucker/sqs-receive-channel v0.1.0
+	github.com/stretchr/testify v1.8.2
+	go.opentelemetry.io/otel/sdk v1.14.0
+	go.opentelemetry.io/otel/trace v1.14.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/go-logr/logr v1.2.3 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/jmespath/go-jmespath v0.0.0-20180206201540-c2b33e8439af // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	go.opentelemetry.io/otel v1.14.0 // indirect
+	golang.org/x/sys v0.5.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/bendrucker/sqs-receive-channel => ../..
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	sqsch "github.com/bendrucker/sqs-receive-channel"
+	"github.com/bendrucker/sqs-receive-channel/fake"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	sqsapi := fake.New(fake.Options{})
+	queue, err := sqsapi.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String("queue")})
+	assert.NoError(t, err)
+
+	dispatch, err := sqsch.New(context.Background(), sqsch.Options{
+		SQS:     sqsapi,
+		Receive: sqsch.ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: queue.QueueUrl}},
+		Delete:  sqsch.DeleteOptions{Interval: time.Millisecond},
+		Send:    sqsch.SendOptions{Interval: time.Millisecond},
+		Tracing: sqsch.TracingOptions{TracerProvider: provider},
+	})
+	assert.NoError(t, err)
+	dispatch.Start(context.Background())
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	input := &sqs.SendMessageInput{MessageBody: aws.String("hello")}
+	dispatch.Inject(ctx, input)
+	parent.End()
+	assert.Contains(t, input.MessageAttributes, "traceparent")
+
+	dispatch.Sends() <- input
+	message := <-dispatch.Receives()
+
+	_, child := provider.Tracer("test").Start(dispatch.MessageContext(context.Background(), message), "handler")
+	child.End()
+
+	dispatch.Deletes() <- message
+	assert.NoError(t, dispatch.Shutdown(context.Background()))
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+
+	producer, consumer := spans["queue send"], spans["queue process"]
+	assert.Equal(t, parent.SpanContext().SpanID(), producer.Parent.SpanID())
+	assert.Equal(t, trace.SpanKindConsumer, consumer.SpanKind)
+	if assert.Len(t, consumer.Links, 1) {
+		assert.Equal(t, producer.SpanContext.SpanID(), consumer.Links[0].SpanContext.SpanID())
+	}
+
+	assert.Equal(t, consumer.SpanContext.SpanID(), spans["handler"].Parent.SpanID())
+	assert.Contains(t, spans, "ReceiveMessage")
+	assert.Contains(t, spans, "DeleteMessageBatch")
+}
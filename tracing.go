@@ -0,0 +1,310 @@
+package sqsch
+
+import (
+	"context"
+	"encoding/hex"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AWSTraceHeader is the system attribute that carries the AWS X-Ray trace header of a message
+const AWSTraceHeader = "AWSTraceHeader"
+
+// MaxMessageAttributes is the largest number of message attributes a message can have
+// https://docs.aws.amazon.com/AWSSimpleQueueService/latest/SQSDeveloperGuide/sqs-message-metadata.html
+const MaxMessageAttributes = 10
+
+// tracerName is the instrumentation name of the tracer
+const tracerName = "github.com/bendrucker/sqs-receive-channel"
+
+// TracingOptions configures OpenTelemetry tracing. Tracing is disabled unless TracerProvider is set.
+type TracingOptions struct {
+	TracerProvider trace.TracerProvider
+	// Propagator reads and writes trace context in message attributes (default: propagation.TraceContext)
+	Propagator propagation.TextMapPropagator
+}
+
+// Defaults sets default values
+func (to *TracingOptions) Defaults() {
+	if to.Enabled() && to.Propagator == nil {
+		to.Propagator = propagation.TraceContext{}
+	}
+}
+
+// Enabled returns whether tracing is enabled
+func (to *TracingOptions) Enabled() bool {
+	return to.TracerProvider != nil
+}
+
+// MessageAttributeCarrier adapts message attributes to a propagation.TextMapCarrier.
+// Trace context is stored in String attributes.
+type MessageAttributeCarrier map[string]*sqs.MessageAttributeValue
+
+// Get returns the value of a String attribute
+func (c MessageAttributeCarrier) Get(key string) string {
+	value, ok := c[key]
+	if !ok || aws.StringValue(value.DataType) != "String" {
+		return ""
+	}
+
+	return aws.StringValue(value.StringValue)
+}
+
+// Set sets a String attribute
+func (c MessageAttributeCarrier) Set(key, value string) {
+	c[key] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+}
+
+// Keys returns the names of the attributes
+func (c MessageAttributeCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// ParseAWSTraceHeader parses the trace ID, parent span ID, and sampling decision from an
+// AWS X-Ray trace header (Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1)
+func ParseAWSTraceHeader(header string) (trace.SpanContext, bool) {
+	var config trace.SpanContextConfig
+
+	for _, part := range strings.Split(header, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+
+		switch key {
+		case "Root":
+			fields := strings.Split(value, "-")
+			if len(fields) != 3 || fields[0] != "1" {
+				return trace.SpanContext{}, false
+			}
+
+			id, err := hex.DecodeString(fields[1] + fields[2])
+			if err != nil || len(id) != len(config.TraceID) {
+				return trace.SpanContext{}, false
+			}
+
+			copy(config.TraceID[:], id)
+		case "Parent":
+			id, err := hex.DecodeString(value)
+			if err != nil || len(id) != len(config.SpanID) {
+				return trace.SpanContext{}, false
+			}
+
+			copy(config.SpanID[:], id)
+		case "Sampled":
+			if value == "1" {
+				config.TraceFlags = trace.FlagsSampled
+			}
+		}
+	}
+
+	config.Remote = true
+	sc := trace.NewSpanContext(config)
+
+	return sc, sc.IsValid()
+}
+
+// tracer returns the configured tracer, or a tracer that records nothing if tracing is disabled
+func (d *Dispatch) tracer() trace.Tracer {
+	if !d.Options.Tracing.Enabled() {
+		return trace.NewNoopTracerProvider().Tracer(tracerName)
+	}
+
+	return d.Options.Tracing.TracerProvider.Tracer(tracerName)
+}
+
+// startRequest starts a span for an SQS API request to the queue at url
+func (d *Dispatch) startRequest(ctx context.Context, operation string, url *string) (context.Context, trace.Span) {
+	return d.tracer().Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "aws-api"),
+			attribute.String("rpc.service", "SQS"),
+			attribute.String("rpc.method", operation),
+			attribute.String("messaging.system", "aws_sqs"),
+			attribute.String("messaging.url", aws.StringValue(url)),
+		),
+	)
+}
+
+// endSpan records err (if any) and ends span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// producerContext returns the span context that a message was sent with, from its message
+// attributes or its AWSTraceHeader system attribute
+func (d *Dispatch) producerContext(message *sqs.Message) (trace.SpanContext, bool) {
+	ctx := d.Options.Tracing.Propagator.Extract(context.Background(), MessageAttributeCarrier(message.MessageAttributes))
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		return sc, true
+	}
+
+	return ParseAWSTraceHeader(aws.StringValue(message.Attributes[AWSTraceHeader]))
+}
+
+// startProcessing starts the consumer span of a received message, linked to its producer span
+func (d *Dispatch) startProcessing(message *sqs.Message) {
+	if !d.Options.Tracing.Enabled() {
+		return
+	}
+
+	options := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "aws_sqs"),
+			attribute.String("messaging.operation", "process"),
+			attribute.String("messaging.message.id", aws.StringValue(message.MessageId)),
+			attribute.String("messaging.url", aws.StringValue(d.MessageQueueURL(message))),
+		),
+	}
+
+	if producer, ok := d.producerContext(message); ok {
+		options = append(options, trace.WithLinks(trace.Link{SpanContext: producer}))
+	}
+
+	_, span := d.tracer().Start(context.Background(), queueName(d.MessageQueueURL(message))+" process", options...)
+	d.spans.add(message, span)
+}
+
+// endProcessing ends the consumer span of a message once it is deleted or released
+func (d *Dispatch) endProcessing(message *sqs.Message, err error) {
+	if span := d.spans.remove(message); span != nil {
+		endSpan(span, err)
+	}
+}
+
+// MessageContext returns a copy of ctx that carries the consumer span of a received message,
+// so that spans started while handling it are its children. It returns ctx if tracing is disabled.
+func (d *Dispatch) MessageContext(ctx context.Context, message *sqs.Message) context.Context {
+	if span := d.spans.get(message); span != nil {
+		return trace.ContextWithSpan(ctx, span)
+	}
+
+	return ctx
+}
+
+// Inject starts a producer span as a child of the span in ctx and adds its context to the
+// message attributes of input, so that the consumer span of the message is linked to it.
+// Messages sent to the send channel without trace context are injected automatically.
+// It does nothing if tracing is disabled or if the trace context would exceed the limit of
+// MaxMessageAttributes.
+func (d *Dispatch) Inject(ctx context.Context, input *sqs.SendMessageInput) {
+	if !d.Options.Tracing.Enabled() {
+		return
+	}
+
+	url := input.QueueUrl
+	if url == nil {
+		url = d.QueueURL()
+	}
+
+	ctx, span := d.tracer().Start(ctx, queueName(url)+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "aws_sqs"),
+			attribute.String("messaging.url", aws.StringValue(url)),
+		),
+	)
+	defer span.End()
+
+	carrier := MessageAttributeCarrier{}
+	d.Options.Tracing.Propagator.Inject(ctx, carrier)
+
+	if len(input.MessageAttributes)+len(carrier) > MaxMessageAttributes {
+		return
+	}
+
+	attributes := make(map[string]*sqs.MessageAttributeValue, len(input.MessageAttributes)+len(carrier))
+	for name, value := range input.MessageAttributes {
+		attributes[name] = value
+	}
+
+	for name, value := range carrier {
+		attributes[name] = value
+	}
+
+	input.MessageAttributes = attributes
+}
+
+// injected returns whether a message already carries trace context
+func (d *Dispatch) injected(input *sqs.SendMessageInput) bool {
+	ctx := d.Options.Tracing.Propagator.Extract(context.Background(), MessageAttributeCarrier(input.MessageAttributes))
+	return trace.SpanContextFromContext(ctx).IsValid()
+}
+
+// messageAttributeNames returns the MessageAttributeNames specified with Options.Receive.ReceiveMessageInput,
+// adding the attributes that carry trace context if tracing is enabled
+func (d *Dispatch) messageAttributeNames() []*string {
+	names := d.Options.Receive.RecieveMessageInput.MessageAttributeNames
+
+	if d.Options.Tracing.Enabled() {
+		for _, field := range d.Options.Tracing.Propagator.Fields() {
+			names = withAttributeName(names, field)
+		}
+	}
+
+	return names
+}
+
+// queueName returns the name of a queue from its URL
+func queueName(queueURL *string) string {
+	u, err := url.Parse(aws.StringValue(queueURL))
+	if err != nil {
+		return aws.StringValue(queueURL)
+	}
+
+	return path.Base(u.Path)
+}
+
+// spans tracks the consumer spans of received messages by receipt handle
+type spans struct {
+	mutex sync.Mutex
+	spans map[string]trace.Span
+}
+
+func newSpans() *spans {
+	return &spans{spans: make(map[string]trace.Span)}
+}
+
+func (s *spans) add(message *sqs.Message, span trace.Span) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.spans[aws.StringValue(message.ReceiptHandle)] = span
+}
+
+func (s *spans) get(message *sqs.Message) trace.Span {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.spans[aws.StringValue(message.ReceiptHandle)]
+}
+
+func (s *spans) remove(message *sqs.Message) trace.Span {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	handle := aws.StringValue(message.ReceiptHandle)
+	span := s.spans[handle]
+	delete(s.spans, handle)
+
+	return span
+}
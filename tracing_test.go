@@ -0,0 +1,41 @@
+package sqsch
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestParseAWSTraceHeader(t *testing.T) {
+	sc, ok := ParseAWSTraceHeader("Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1")
+	assert.True(t, ok)
+	assert.Equal(t, "5759e988bd862e3fe1be46a994272793", sc.TraceID().String())
+	assert.Equal(t, "53995c3f42cd8ad8", sc.SpanID().String())
+	assert.True(t, sc.IsSampled())
+	assert.True(t, sc.IsRemote())
+
+	_, ok = ParseAWSTraceHeader("Root=1-5759e988-bd862e3fe1be46a994272793")
+	assert.False(t, ok, "missing parent")
+
+	_, ok = ParseAWSTraceHeader("Root=2-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8")
+	assert.False(t, ok, "unknown version")
+
+	_, ok = ParseAWSTraceHeader("")
+	assert.False(t, ok)
+}
+
+func TestProducerContextAWSTraceHeader(t *testing.T) {
+	dispatch := newUnvalidated(Options{Tracing: TracingOptions{TracerProvider: trace.NewNoopTracerProvider()}})
+
+	sc, ok := dispatch.producerContext(&sqs.Message{
+		Attributes: map[string]*string{
+			AWSTraceHeader: aws.String("Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"),
+		},
+	})
+
+	assert.True(t, ok)
+	assert.Equal(t, "53995c3f42cd8ad8", sc.SpanID().String())
+}
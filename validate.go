@@ -0,0 +1,269 @@
+package sqsch
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+// ValidationError represents an invalid option. Field is the path of the option within Options.
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+func (err *ValidationError) Error() string {
+	return fmt.Sprintf("invalid option %s: %s", err.Field, err.Reason)
+}
+
+// QueueNameError represents a failure to resolve a queue name to its URL with GetQueueUrl
+type QueueNameError struct {
+	Name string
+	Err  error
+}
+
+func (err *QueueNameError) Error() string {
+	return fmt.Sprintf("failed to get URL of queue %s: %s", err.Name, err.Err)
+}
+
+// Unwrap returns the error returned by GetQueueUrl
+func (err *QueueNameError) Unwrap() error {
+	return err.Err
+}
+
+func invalid(field, format string, args ...interface{}) error {
+	return &ValidationError{Field: field, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Validate returns a *ValidationError describing the first invalid option, or nil if the
+// options are valid. Call it after Defaults.
+func (o *Options) Validate() error {
+	if o.SQS == nil {
+		return invalid("SQS", "is required")
+	}
+
+	if o.ShutdownTimeout < 0 {
+		return invalid("ShutdownTimeout", "must not be negative")
+	}
+
+	validators := []func() error{
+		o.Receive.validate,
+		o.Delete.validate,
+		o.Heartbeat.validate,
+		o.Send.validate,
+		o.Errors.validate,
+		o.Decode.validate,
+	}
+
+	for _, validate := range validators {
+		if err := validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ro *ReceiveOptions) validate() error {
+	queueURL := ro.RecieveMessageInput.QueueUrl
+
+	switch {
+	case queueURL == nil && ro.QueueName == "" && len(ro.Queues) == 0:
+		return invalid("Receive.RecieveMessageInput.QueueUrl", "is required unless Receive.QueueName or Receive.Queues is set")
+	case queueURL != nil && ro.QueueName != "":
+		return invalid("Receive.QueueName", "conflicts with Receive.RecieveMessageInput.QueueUrl")
+	case queueURL != nil && len(ro.Queues) > 0:
+		return invalid("Receive.RecieveMessageInput.QueueUrl", "conflicts with Receive.Queues")
+	case ro.QueueName != "" && len(ro.Queues) > 0:
+		return invalid("Receive.QueueName", "conflicts with Receive.Queues")
+	case queueURL != nil:
+		if err := validateURL("Receive.RecieveMessageInput.QueueUrl", aws.StringValue(queueURL)); err != nil {
+			return err
+		}
+	}
+
+	for i, queue := range ro.Queues {
+		field := fmt.Sprintf("Receive.Queues[%d]", i)
+
+		switch {
+		case queue.URL == nil && queue.Name == "":
+			return invalid(field, "requires URL or Name")
+		case queue.URL != nil && queue.Name != "":
+			return invalid(field+".Name", "conflicts with URL")
+		case queue.URL != nil:
+			if err := validateURL(field+".URL", aws.StringValue(queue.URL)); err != nil {
+				return err
+			}
+		}
+
+		if queue.Weight < 0 {
+			return invalid(field+".Weight", "must not be negative")
+		}
+	}
+
+	input := ro.RecieveMessageInput
+
+	if seconds := aws.Int64Value(input.WaitTimeSeconds); seconds < 0 || time.Duration(seconds)*time.Second > MaxLongPollDuration {
+		return invalid("Receive.RecieveMessageInput.WaitTimeSeconds", "must be between 0 and %d", int64(MaxLongPollDuration/time.Second))
+	}
+
+	if max := input.MaxNumberOfMessages; max != nil && (*max < 1 || *max > MaxBatchSize) {
+		return invalid("Receive.RecieveMessageInput.MaxNumberOfMessages", "must be between 1 and %d", MaxBatchSize)
+	}
+
+	if seconds := aws.Int64Value(input.VisibilityTimeout); seconds < 0 || time.Duration(seconds)*time.Second > MaxVisibilityTimeout {
+		return invalid("Receive.RecieveMessageInput.VisibilityTimeout", "must be between 0 and %d", int64(MaxVisibilityTimeout/time.Second))
+	}
+
+	if input.ReceiveRequestAttemptId != nil {
+		return invalid("Receive.RecieveMessageInput.ReceiveRequestAttemptId", "cannot be set because each request needs its own; set Receive.FIFO to generate them")
+	}
+
+	if ro.IdleInterval < 0 {
+		return invalid("Receive.IdleInterval", "must not be negative")
+	}
+
+	if ro.Breaker.Threshold < 0 {
+		return invalid("Receive.Breaker.Threshold", "must not be negative")
+	}
+
+	if ro.Breaker.Cooldown < 0 {
+		return invalid("Receive.Breaker.Cooldown", "must not be negative")
+	}
+
+	if ro.Priority != PriorityStrict && ro.Priority != PriorityWeighted {
+		return invalid("Receive.Priority", "unknown priority %d", ro.Priority)
+	}
+
+	if ro.BufferSize < 0 {
+		return invalid("Receive.BufferSize", "must not be negative")
+	}
+
+	if ro.Workers != nil && cap(ro.Workers) == 0 {
+		return invalid("Receive.Workers", "must be buffered with a capacity of the desired concurrency")
+	}
+
+	return nil
+}
+
+func validateURL(field, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return invalid(field, "%q is not an absolute URL", value)
+	}
+
+	return nil
+}
+
+func (do *DeleteOptions) validate() error {
+	if do.Interval < 0 {
+		return invalid("Delete.Interval", "must not be negative")
+	}
+
+	if do.Concurrency < 0 {
+		return invalid("Delete.Concurrency", "must not be negative")
+	}
+
+	return nil
+}
+
+func (ho *HeartbeatOptions) validate() error {
+	if ho.Interval < 0 {
+		return invalid("Heartbeat.Interval", "must not be negative")
+	}
+
+	if !ho.Enabled() {
+		return nil
+	}
+
+	if ho.VisibilityTimeout <= ho.Interval {
+		return invalid("Heartbeat.VisibilityTimeout", "must be longer than Heartbeat.Interval (%s)", ho.Interval)
+	}
+
+	if ho.VisibilityTimeout > MaxVisibilityTimeout {
+		return invalid("Heartbeat.VisibilityTimeout", "must not exceed %s", MaxVisibilityTimeout)
+	}
+
+	return nil
+}
+
+func (so *SendOptions) validate() error {
+	if so.Interval < 0 {
+		return invalid("Send.Interval", "must not be negative")
+	}
+
+	if so.Concurrency < 0 {
+		return invalid("Send.Concurrency", "must not be negative")
+	}
+
+	if so.MaxAttempts < 0 {
+		return invalid("Send.MaxAttempts", "must not be negative")
+	}
+
+	return nil
+}
+
+func (eo *ErrorOptions) validate() error {
+	if eo.BufferSize < 0 {
+		return invalid("Errors.BufferSize", "must not be negative")
+	}
+
+	return nil
+}
+
+func (do *DecodeOptions) validate() error {
+	if do.Failure == DecodeFailureDeadLetter && do.DeadLetterQueueURL == nil {
+		return invalid("Decode.DeadLetterQueueURL", "is required when Decode.Failure is DecodeFailureDeadLetter")
+	}
+
+	return nil
+}
+
+// resolve replaces queue names with the queue URLs returned by GetQueueUrl
+func (ro *ReceiveOptions) resolve(ctx context.Context, sqsapi sqsiface.SQSAPI) error {
+	if ro.QueueName != "" {
+		queueURL, err := resolveQueueURL(ctx, sqsapi, ro.QueueName)
+		if err != nil {
+			return err
+		}
+
+		input := *ro.RecieveMessageInput
+		input.QueueUrl = queueURL
+		ro.RecieveMessageInput = &input
+	}
+
+	queues := make([]Queue, len(ro.Queues))
+
+	for i, queue := range ro.Queues {
+		if queue.Name != "" {
+			queueURL, err := resolveQueueURL(ctx, sqsapi, queue.Name)
+			if err != nil {
+				return err
+			}
+
+			queue.URL = queueURL
+		}
+
+		queues[i] = queue
+	}
+
+	if len(queues) > 0 {
+		ro.Queues = queues
+	}
+
+	return nil
+}
+
+func resolveQueueURL(ctx context.Context, sqsapi sqsiface.SQSAPI, name string) (*string, error) {
+	output, err := sqsapi.GetQueueUrlWithContext(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(name)})
+	if err != nil {
+		return nil, &QueueNameError{Name: name, Err: err}
+	}
+
+	return output.QueueUrl, nil
+}
@@ -0,0 +1,130 @@
+package sqsch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/bendrucker/sqs-receive-channel/fake"
+	"github.com/bendrucker/sqs-receive-channel/pkg/receive"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	sqsapi := fake.New(fake.Options{})
+	queueURL := aws.String("https://sqs.us-east-1.amazonaws.com/000000000000/queue")
+	input := &sqs.ReceiveMessageInput{QueueUrl: queueURL}
+
+	cases := []struct {
+		field   string
+		options Options
+	}{
+		{"SQS", Options{Receive: ReceiveOptions{RecieveMessageInput: input}}},
+		{"Receive.RecieveMessageInput.QueueUrl", Options{SQS: sqsapi}},
+		{"ShutdownTimeout", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: input}, ShutdownTimeout: -1}},
+		{"Receive.RecieveMessageInput.QueueUrl", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: aws.String("queue")}}}},
+		{"Receive.QueueName", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: input, QueueName: "queue"}}},
+		{"Receive.RecieveMessageInput.QueueUrl", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: input, Queues: []Queue{{URL: queueURL}}}}},
+		{"Receive.QueueName", Options{SQS: sqsapi, Receive: ReceiveOptions{QueueName: "queue", Queues: []Queue{{URL: queueURL}}}}},
+		{"Receive.Queues[1]", Options{SQS: sqsapi, Receive: ReceiveOptions{Queues: []Queue{{URL: queueURL}, {}}}}},
+		{"Receive.Queues[0].Weight", Options{SQS: sqsapi, Receive: ReceiveOptions{Queues: []Queue{{URL: queueURL, Weight: -1}}}}},
+		{"Receive.RecieveMessageInput.WaitTimeSeconds", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: queueURL, WaitTimeSeconds: aws.Int64(21)}}}},
+		{"Receive.RecieveMessageInput.MaxNumberOfMessages", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: queueURL, MaxNumberOfMessages: aws.Int64(0)}}}},
+		{"Receive.RecieveMessageInput.VisibilityTimeout", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: queueURL, VisibilityTimeout: aws.Int64(-1)}}}},
+		{"Receive.RecieveMessageInput.ReceiveRequestAttemptId", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: &sqs.ReceiveMessageInput{QueueUrl: queueURL, ReceiveRequestAttemptId: aws.String("attempt")}}}},
+		{"Receive.IdleInterval", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: input, IdleInterval: -1}}},
+		{"Receive.Breaker.Threshold", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: input, Breaker: receive.BreakerOptions{Threshold: -1}}}},
+		{"Receive.Priority", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: input, Priority: 5}}},
+		{"Receive.BufferSize", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: input, BufferSize: -1}}},
+		{"Receive.Workers", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: input, Workers: make(chan Worker)}}},
+		{"Delete.Interval", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: input}, Delete: DeleteOptions{Interval: -1}}},
+		{"Heartbeat.VisibilityTimeout", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: input}, Heartbeat: HeartbeatOptions{Interval: time.Minute, VisibilityTimeout: time.Second}}},
+		{"Send.MaxAttempts", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: input}, Send: SendOptions{MaxAttempts: -1}}},
+		{"Errors.BufferSize", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: input}, Errors: ErrorOptions{BufferSize: -1}}},
+		{"Decode.DeadLetterQueueURL", Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: input}, Decode: DecodeOptions{Failure: DecodeFailureDeadLetter}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.field, func(t *testing.T) {
+			dispatch, err := New(context.Background(), c.options)
+			assert.Nil(t, dispatch)
+
+			var validation *ValidationError
+			if assert.True(t, errors.As(err, &validation)) {
+				assert.Equal(t, c.field, validation.Field)
+			}
+		})
+	}
+
+	receive, _, errs := Start(context.Background(), Options{})
+	var validation *ValidationError
+	assert.True(t, errors.As(<-errs, &validation))
+	_, ok := <-receive
+	assert.False(t, ok)
+	_, ok = <-errs
+	assert.False(t, ok)
+
+	err := Serve(context.Background(), Options{}, HandlerFunc(func(ctx context.Context, message *sqs.Message) error {
+		return nil
+	}))
+	assert.Error(t, err)
+}
+
+func TestResolveQueueNames(t *testing.T) {
+	sqsapi := fake.New(fake.Options{})
+
+	var urls []*string
+	for _, name := range []string{"queue", "high", "low"} {
+		output, err := sqsapi.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String(name)})
+		assert.NoError(t, err)
+		urls = append(urls, output.QueueUrl)
+	}
+
+	input := &sqs.ReceiveMessageInput{VisibilityTimeout: aws.Int64(10)}
+	dispatch, err := New(context.Background(), Options{SQS: sqsapi, Receive: ReceiveOptions{RecieveMessageInput: input, QueueName: "queue"}})
+	assert.NoError(t, err)
+	assert.Equal(t, urls[0], dispatch.QueueURL())
+	assert.Equal(t, aws.Int64(10), dispatch.Options.Receive.RecieveMessageInput.VisibilityTimeout)
+	assert.Nil(t, input.QueueUrl, "does not modify the caller's input")
+
+	queues := []Queue{{Name: "high"}, {URL: urls[2]}}
+	dispatch, err = New(context.Background(), Options{SQS: sqsapi, Receive: ReceiveOptions{Queues: queues}})
+	assert.NoError(t, err)
+	assert.Equal(t, []*string{urls[1], urls[2]}, dispatch.Options.Receive.order())
+	assert.Nil(t, queues[0].URL, "does not modify the caller's queues")
+
+	_, err = New(context.Background(), Options{SQS: sqsapi, Receive: ReceiveOptions{QueueName: "missing"}})
+
+	var resolve *QueueNameError
+	if assert.True(t, errors.As(err, &resolve)) {
+		assert.Equal(t, "missing", resolve.Name)
+
+		var aerr awserr.Error
+		assert.True(t, errors.As(err, &aerr))
+		assert.Equal(t, sqs.ErrCodeQueueDoesNotExist, aerr.Code())
+	}
+}
+
+func TestResolveQueueNamesContext(t *testing.T) {
+	ctx, sqsapi, finish := setup(t)
+	defer finish()
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	sqsapi.
+		EXPECT().
+		GetQueueUrlWithContext(gomock.Any(), &sqs.GetQueueUrlInput{QueueName: aws.String("queue")}).
+		DoAndReturn(func(ctx context.Context, _ *sqs.GetQueueUrlInput, _ ...request.Option) (*sqs.GetQueueUrlOutput, error) {
+			return nil, ctx.Err()
+		})
+
+	_, err := New(ctx, Options{SQS: sqsapi, Receive: ReceiveOptions{QueueName: "queue"}})
+	assert.True(t, errors.Is(err, context.Canceled))
+}